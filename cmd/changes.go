@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Describes the object level differences between a newly exported set of
+// objects and the version they will replace. Entries are kind/name strings.
+type ChangeSet struct {
+	Added []string
+	Modified []string
+	Deleted []string
+
+	// Prior paths of modified objects whose file has moved, such as objects
+	// stored under a legacy kind directory (e.g. deploymentconfigs).
+	movedFrom map[string]string
+}
+
+func (cs *ChangeSet) Empty() bool {
+	return len( cs.Added ) == 0 && len( cs.Modified ) == 0 && len( cs.Deleted ) == 0
+}
+
+func (cs *ChangeSet) sort() {
+	sort.Strings( cs.Added )
+	sort.Strings( cs.Modified )
+	sort.Strings( cs.Deleted )
+}
+
+// Prints a human readable summary of the change set against the named version.
+func (cs *ChangeSet) Report( against string ) {
+	if cs.Empty() {
+		Out.Info( "No object changes relative to %v", against )
+		return
+	}
+	Out.Info( "Object changes relative to %v: %v added, %v modified, %v removed", against, len( cs.Added ), len( cs.Modified ), len( cs.Deleted ) )
+	for _, name := range cs.Added {
+		Out.Info( "  + %v", name )
+	}
+	for _, name := range cs.Modified {
+		Out.Info( "  ~ %v", name )
+	}
+	for _, name := range cs.Deleted {
+		Out.Info( "  - %v", name )
+	}
+}
+
+// Formats the change set for inclusion in a commit message body.
+func (cs *ChangeSet) Summary() string {
+	var lines []string
+	section := func( title string, names []string ) {
+		if len( names ) == 0 {
+			return
+		}
+		lines = append( lines, title + ":" )
+		for _, name := range names {
+			lines = append( lines, "  " + name )
+		}
+	}
+	section( "Added", cs.Added )
+	section( "Modified", cs.Modified )
+	section( "Deleted", cs.Deleted )
+	return strings.Join( lines, "\n" )
+}
+
+// Returns the path of an object file relative to the root of the git repository.
+func gitObjectPath( xr *XR, fullName string ) string {
+	return path.Join( xr.Spec.Git.Branch.ContextDir, fullName + "." + xr.Spec.Format )
+}
+
+// Compares the git index against ref (e.g. the version branch) and returns
+// the object files which differ beneath the XR's context directory.
+func (git *GitCmd) StagedChanges( xr *XR, ref string ) (*ChangeSet, error) {
+	contextDir := xr.Spec.Git.Branch.ContextDir
+	if contextDir == "" {
+		contextDir = "."
+	}
+
+	so, se, err := git.Exec( "diff", "--cached", "--name-status", "--no-renames", ref, "--", contextDir )
+	if err != nil {
+		return nil, fmt.Errorf( "Unable to compute staged changes [%v]: %v", err, se )
+	}
+
+	cs := &ChangeSet{ movedFrom: map[string]string{} }
+	deleted := map[string]string{}
+	var added []string
+	for _, line := range strings.Split( so, "\n" ) {
+		fields := strings.SplitN( line, "\t", 2 )
+		if len( fields ) != 2 || ! strings.HasSuffix( fields[1], "." + xr.Spec.Format ) {
+			continue
+		}
+		// Earlier releases named kind directories differently; normalizing
+		// pairs an object's old and new files.
+		fullName := NormalizeType( GetFullObjectNameFromPath( fields[1] ) )
+		switch fields[0][:1] {
+		case "A":
+			added = append( added, fullName )
+		case "D":
+			deleted[ fullName ] = fields[1]
+		default:
+			cs.Modified = append( cs.Modified, fullName )
+		}
+	}
+
+	for _, fullName := range added {
+		if priorPath, ok := deleted[ fullName ]; ok {
+			cs.Modified = append( cs.Modified, fullName )
+			cs.movedFrom[ fullName ] = priorPath
+			delete( deleted, fullName )
+		} else {
+			cs.Added = append( cs.Added, fullName )
+		}
+	}
+	for fullName := range deleted {
+		cs.Deleted = append( cs.Deleted, fullName )
+	}
+	cs.sort()
+	return cs, nil
+}
+
+// Reverts modified objects to their content in ref when equivalent reports
+// that the staged content does not meaningfully differ. Reverted objects are
+// removed from the change set.
+func (git *GitCmd) RevertEquivalent( xr *XR, ref string, cs *ChangeSet, equivalent func( old, new string ) bool ) error {
+	var modified []string
+	for _, fullName := range cs.Modified {
+		objPath := gitObjectPath( xr, fullName )
+		priorPath := objPath
+		if moved, ok := cs.movedFrom[ fullName ]; ok {
+			priorPath = moved
+		}
+
+		oldContent, se, err := git.Exec( "show", ref + ":" + priorPath )
+		if err != nil {
+			return fmt.Errorf( "Unable to read prior content of %v [%v]: %v", fullName, err, se )
+		}
+
+		newContent, se, err := git.Exec( "show", ":" + objPath )
+		if err != nil {
+			return fmt.Errorf( "Unable to read staged content of %v [%v]: %v", fullName, err, se )
+		}
+
+		if ! equivalent( oldContent, newContent ) {
+			modified = append( modified, fullName )
+			continue
+		}
+
+		Out.Debug( "Object is unchanged aside from generated content: %v", fullName )
+		if priorPath != objPath {
+			// Leave an unchanged object where it is rather than moving it
+			_, se, err = git.Exec( "rm", "-q", "-f", "--", objPath )
+			if err != nil {
+				return fmt.Errorf( "Unable to revert %v [%v]: %v", fullName, err, se )
+			}
+		}
+		_, se, err = git.Exec( "checkout", ref, "--", priorPath )
+		if err != nil {
+			return fmt.Errorf( "Unable to revert %v [%v]: %v", fullName, err, se )
+		}
+	}
+	cs.Modified = modified
+	return nil
+}
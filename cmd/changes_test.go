@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTestObject( t *testing.T, dir string, relPath string, content string ) {
+	path := filepath.Join( dir, relPath )
+	if err := os.MkdirAll( filepath.Dir( path ), 0700 ); err != nil {
+		t.Fatal( err )
+	}
+	if err := ioutil.WriteFile( path, []byte( content ), 0600 ); err != nil {
+		t.Fatal( err )
+	}
+}
+
+// Creates an empty git repository and returns a function which runs git
+// commands in it.
+func newTestGitRepo( t *testing.T ) (*GitCmd, func( args... string )) {
+	dir := t.TempDir()
+	git := &GitCmd{ repoDir: dir, objectDir: dir }
+	run := func( args... string ) {
+		if _, se, err := git.Exec( args... ); err != nil {
+			t.Fatalf( "git %v [%v]: %v", args, se, err )
+		}
+	}
+	run( "init", "-q", "-b", "master" )
+	run( "config", "user.email", "test@example.com" )
+	run( "config", "user.name", "test" )
+	run( "config", "commit.gpgsign", "false" )
+	return git, run
+}
+
+// Creates a git repository whose HEAD holds objects in legacy kind
+// directories, then stages the same objects under current names.
+func newLegacyGitRepo( t *testing.T ) (*GitCmd, *XR) {
+	useBuiltinKinds( t )
+	git, run := newTestGitRepo( t )
+	dir := git.repoDir
+
+	writeTestObject( t, dir, "deploymentconfigs/same.json", `{"image":"app:v1_100"}` )
+	writeTestObject( t, dir, "deploymentconfigs/changed.json", `{"replicas":1}` )
+	run( "add", "." )
+	run( "commit", "-q", "-m", "prior" )
+
+	run( "rm", "-q", "-r", "deploymentconfigs" )
+	writeTestObject( t, dir, KIND_DC + "/same.json", `{"image":"app:v1_200"}` )
+	writeTestObject( t, dir, KIND_DC + "/changed.json", `{"replicas":2}` )
+	run( "add", "." )
+
+	xr := &XR{}
+	xr.Spec.Format = "json"
+	return git, xr
+}
+
+func TestStagedChangesLegacyKindDirectories( t *testing.T ) {
+	git, xr := newLegacyGitRepo( t )
+
+	cs, err := git.StagedChanges( xr, "HEAD" )
+	if err != nil {
+		t.Fatal( err )
+	}
+	expected := []string{ KIND_DC + "/changed", KIND_DC + "/same" }
+	if len( cs.Added ) != 0 || len( cs.Deleted ) != 0 || !reflect.DeepEqual( cs.Modified, expected ) {
+		t.Fatalf( "changes = %+v, expected only modifications %v", cs, expected )
+	}
+
+	err = git.RevertEquivalent( xr, "HEAD", cs, func( old, new string ) bool {
+		return old == `{"image":"app:v1_100"}` && new == `{"image":"app:v1_200"}`
+	})
+	if err != nil {
+		t.Fatal( err )
+	}
+	if !reflect.DeepEqual( cs.Modified, []string{ KIND_DC + "/changed" } ) {
+		t.Errorf( "modified after revert = %v", cs.Modified )
+	}
+
+	// The unchanged object stays in its legacy directory
+	if _, err := os.Stat( filepath.Join( git.repoDir, "deploymentconfigs/same.json" ) ); err != nil {
+		t.Errorf( "unchanged object was not restored: %v", err )
+	}
+	if _, err := os.Stat( filepath.Join( git.repoDir, KIND_DC, "same.json" ) ); !os.IsNotExist( err ) {
+		t.Errorf( "unchanged object was left in the new directory: %v", err )
+	}
+
+	cs, err = git.StagedChanges( xr, "HEAD" )
+	if err != nil {
+		t.Fatal( err )
+	}
+	if !reflect.DeepEqual( cs.Modified, []string{ KIND_DC + "/changed" } ) || len( cs.Added ) != 0 || len( cs.Deleted ) != 0 {
+		t.Errorf( "changes after revert = %+v", cs )
+	}
+}
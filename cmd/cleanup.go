@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"fmt"
+)
+
+// Removes a field from exported objects. Values listed in Except are
+// preserved (e.g. a headless service's clusterIP "None"). When is an
+// optional condition on another field of the same object.
+type CleanupRule struct {
+	Match string `json:"match"` // kind/name list; empty matches every object
+	Path string `json:"path"`
+	Except []string `json:"except"`
+	When *CleanupCondition `json:"when"`
+}
+
+// Satisfied when a value at Path has the string form Value.
+type CleanupCondition struct {
+	Path string `json:"path"`
+	Value string `json:"value"`
+}
+
+// Server populated and cluster specific fields which prevent objects from
+// being recreated elsewhere or cause spurious differences between exports.
+var defaultCleanupRules = []CleanupRule{
+	{ Path: "status" },
+	{ Path: "metadata.uid" },
+	{ Path: "metadata.resourceVersion" },
+	{ Path: "metadata.creationTimestamp" },
+	{ Path: "metadata.generation" },
+	{ Path: "metadata.selfLink" },
+	{ Path: "metadata.managedFields" },
+	{ Path: `metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]` },
+	{ Match: KIND_SERVICE, Path: "spec.clusterIP", Except: []string{ "None" } },
+	{ Match: KIND_SERVICE, Path: "spec.clusterIPs", Except: []string{ "None" } },
+	{ Match: KIND_SERVICE, Path: "spec.ports[*].nodePort" },
+	{ Match: KIND_ROUTE, Path: "spec.host", When: &CleanupCondition{ Path: `metadata.annotations["openshift.io/host.generated"]`, Value: "true" } },
+}
+
+// Default rules which remove claims' bindings to source cluster volumes.
+// They are skipped when the import storage rules preserve volume bindings.
+var volumeBindingCleanupRules = []CleanupRule{
+	{ Match: KIND_PVC, Path: "spec.volumeName" },
+	{ Match: KIND_PVC, Path: `metadata.annotations["pv.kubernetes.io/bind-completed"]` },
+	{ Match: KIND_PVC, Path: `metadata.annotations["pv.kubernetes.io/bound-by-controller"]` },
+}
+
+type compiledCleanupRule struct {
+	rule CleanupRule
+	path *FieldPath
+	when *FieldPath
+}
+
+type Cleanup struct {
+	rules []compiledCleanupRule
+	preserveOwnerReferences bool
+}
+
+// Builds the cleanup stage for an XR. The defaults apply unless disabled;
+// individual default paths can be retained with keep.
+func NewCleanup( xr *XR ) (*Cleanup, error) {
+	config := xr.Spec.ExportRules.Transforms.Cleanup
+	keep := map[string]struct{}{}
+	for _, path := range config.Keep {
+		keep[ path ] = struct{}{}
+	}
+
+	defaults := defaultCleanupRules
+	if ! xr.Spec.ImportRules.Transforms.Storage.PreserveVolumeBindings {
+		defaults = append( defaults[:len( defaults ):len( defaults )], volumeBindingCleanupRules... )
+	}
+
+	var rules []CleanupRule
+	if ! config.DisableDefaults {
+		for _, rule := range defaults {
+			if _, ok := keep[ rule.Path ]; !ok {
+				rules = append( rules, rule )
+			}
+		}
+	}
+	rules = append( rules, config.Remove... )
+
+	c := &Cleanup{ preserveOwnerReferences: config.PreserveOwnerReferences }
+	for _, rule := range rules {
+		path, err := ParseFieldPath( rule.Path )
+		if err != nil {
+			return nil, err
+		}
+		compiled := compiledCleanupRule{ rule: rule, path: path }
+		if rule.When != nil {
+			compiled.when, err = ParseFieldPath( rule.When.Path )
+			if err != nil {
+				return nil, err
+			}
+		}
+		c.rules = append( c.rules, compiled )
+	}
+	return c, nil
+}
+
+// Removes the fields selected by the cleanup rules from an object.
+func (c *Cleanup) Apply( fullName string, obj map[string]interface{} ) {
+	for _, r := range c.rules {
+		if r.rule.Match != "" && ! IsMatchedByKindNameList( fullName, r.rule.Match ) {
+			continue
+		}
+		if r.when != nil && ! valuesContain( r.when.Values( obj ), r.rule.When.Value ) {
+			continue
+		}
+		removed := r.path.Remove( obj, func( v interface{} ) bool {
+			for _, except := range r.rule.Except {
+				if valuesContain( []interface{}{ v }, except ) {
+					return true
+				}
+			}
+			return false
+		})
+		if removed > 0 {
+			Out.Debug( "Cleanup removed %v from %v", r.path, fullName )
+		}
+	}
+}
+
+// Returns the kind/name of the object an owner reference names.
+func ownerReferenceName( ref interface{} ) string {
+	apiVersion, _ := GetJSONPath( ref, "apiVersion" ).(string)
+	kind, _ := GetJSONPath( ref, "kind" ).(string)
+	name, _ := GetJSONPath( ref, "name" ).(string)
+	return ResourceNameForObject( apiVersion, kind ) + "/" + name
+}
+
+// Removes owner references to objects which are not in the exported set.
+// The owner would not exist after import and the garbage collector would
+// delete the object. Kept references lose their uid, which is that of the
+// owner in the source cluster; replace sets the uid of the imported owner.
+func (c *Cleanup) ApplyOwnerReferences( fullName string, obj map[string]interface{}, exported map[string]struct{} ) {
+	if c.preserveOwnerReferences {
+		return
+	}
+	path, _ := ParseFieldPath( "metadata.ownerReferences[*]" )
+	path.Remove( obj, func( v interface{} ) bool {
+		owner := ownerReferenceName( v )
+		if _, ok := exported[ owner ]; ok {
+			if ref, ok := v.(map[string]interface{}); ok {
+				delete( ref, "uid" )
+			}
+			return true
+		}
+		Out.Debug( "Cleanup removed owner reference to %v from %v", owner, fullName )
+		return false
+	})
+	if refs, ok := GetJSONPath( obj, "metadata", "ownerReferences" ).([]interface{}); ok && len( refs ) == 0 {
+		delete( obj["metadata"].(map[string]interface{}), "ownerReferences" )
+	}
+}
+
+// Returns the kind/names of owners referenced without a uid.
+func UnresolvedOwners( obj map[string]interface{} ) []string {
+	var owners []string
+	refs, _ := GetJSONPath( obj, "metadata", "ownerReferences" ).([]interface{})
+	for _, ref := range refs {
+		if uid, _ := GetJSONPath( ref, "uid" ).(string); uid == "" {
+			owners = append( owners, ownerReferenceName( ref ) )
+		}
+	}
+	return owners
+}
+
+// Sets the uid of owner references which have none to that of the live
+// owner in the namespace. References to owners which do not exist are
+// removed so that the garbage collector does not delete the object.
+func ResolveOwnerReferences( namespace string, fullName string, obj map[string]interface{} ) error {
+	refs, _ := GetJSONPath( obj, "metadata", "ownerReferences" ).([]interface{})
+	if len( refs ) == 0 {
+		return nil
+	}
+	var resolved []interface{}
+	for _, r := range refs {
+		ref, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if uid, _ := ref[ "uid" ].(string); uid != "" {
+			resolved = append( resolved, ref )
+			continue
+		}
+		kind := ResourceNameForObject( fmt.Sprint( ref[ "apiVersion" ] ), fmt.Sprint( ref[ "kind" ] ) )
+		name, _ := ref[ "name" ].(string)
+		live, err := OC.Get( namespace, kind, name )
+		if IsNotFound( err ) {
+			Out.Warn( "Removing owner reference of %v to %v/%v, which does not exist", fullName, kind, name )
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf( "Unable to read owner %v/%v of %v: %v", kind, name, fullName, err )
+		}
+		ref[ "uid" ] = string( live.GetUID() )
+		resolved = append( resolved, ref )
+	}
+
+	metadata := obj[ "metadata" ].(map[string]interface{})
+	if len( resolved ) == 0 {
+		delete( metadata, "ownerReferences" )
+	} else {
+		metadata[ "ownerReferences" ] = resolved
+	}
+	return nil
+}
+
+// Returns true if any value, or any element of an array value, has the
+// string form s.
+func valuesContain( values []interface{}, s string ) bool {
+	for _, v := range values {
+		if arr, ok := v.([]interface{}); ok {
+			if valuesContain( arr, s ) {
+				return true
+			}
+			continue
+		}
+		if fmt.Sprint( v ) == s {
+			return true
+		}
+	}
+	return false
+}
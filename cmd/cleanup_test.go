@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const testOwnedConfigMap = `{
+	"apiVersion": "v1",
+	"kind": "ConfigMap",
+	"metadata": {
+		"name": "settings",
+		"ownerReferences": [
+			{ "apiVersion": "apps/v1", "kind": "Deployment", "name": "web", "uid": "source-web", "controller": true },
+			{ "apiVersion": "apps/v1", "kind": "Deployment", "name": "missing", "uid": "source-missing" }
+		]
+	}
+}`
+
+func TestApplyOwnerReferences( t *testing.T ) {
+	useBuiltinKinds( t )
+	c, err := NewCleanup( &XR{} )
+	if err != nil {
+		t.Fatal( err )
+	}
+
+	obj := parseTestObject( t, testOwnedConfigMap )
+	c.ApplyOwnerReferences( "configmaps/settings", obj, map[string]struct{}{ "deployments.apps/web": {} } )
+
+	expected := []interface{}{
+		map[string]interface{}{ "apiVersion": "apps/v1", "kind": "Deployment", "name": "web", "controller": true },
+	}
+	refs := GetJSONPath( obj, "metadata", "ownerReferences" )
+	if !reflect.DeepEqual( refs, expected ) {
+		t.Errorf( "owner references = %v, expected %v", refs, expected )
+	}
+	if owners := UnresolvedOwners( obj ); !reflect.DeepEqual( owners, []string{ "deployments.apps/web" } ) {
+		t.Errorf( "unresolved owners = %v", owners )
+	}
+
+	// Without exported owners the field is removed
+	obj = parseTestObject( t, testOwnedConfigMap )
+	c.ApplyOwnerReferences( "configmaps/settings", obj, map[string]struct{}{} )
+	if _, ok := obj[ "metadata" ].(map[string]interface{})[ "ownerReferences" ]; ok {
+		t.Errorf( "owner references were not removed: %v", obj[ "metadata" ] )
+	}
+}
+
+func TestResolveOwnerReferences( t *testing.T ) {
+	web := testObject( "apps/v1", "Deployment", "demo", "web", nil )
+	web.SetUID( "target-web" )
+	newTestCluster( t, web )
+
+	obj := parseTestObject( t, testOwnedConfigMap )
+	refs := GetJSONPath( obj, "metadata", "ownerReferences" ).([]interface{})
+	for _, ref := range refs {
+		delete( ref.(map[string]interface{}), "uid" )
+	}
+
+	err := ResolveOwnerReferences( "demo", "configmaps/settings", obj )
+	if err != nil {
+		t.Fatal( err )
+	}
+
+	// The reference to the missing owner is dropped rather than left dangling
+	expected := []interface{}{
+		map[string]interface{}{ "apiVersion": "apps/v1", "kind": "Deployment", "name": "web", "uid": "target-web", "controller": true },
+	}
+	if refs := GetJSONPath( obj, "metadata", "ownerReferences" ); !reflect.DeepEqual( refs, expected ) {
+		t.Errorf( "owner references = %v, expected %v", refs, expected )
+	}
+	if owners := UnresolvedOwners( obj ); len( owners ) != 0 {
+		t.Errorf( "unresolved owners = %v", owners )
+	}
+}
+
+func TestCleanupApply( t *testing.T ) {
+	useBuiltinKinds( t )
+	service := `{
+		"kind": "Service",
+		"metadata": { "name": "db", "uid": "u", "resourceVersion": "1", "annotations": { "kubectl.kubernetes.io/last-applied-configuration": "{}", "keep": "me" } },
+		"spec": { "clusterIP": "None", "ports": [ { "port": 5432, "nodePort": 30432 } ] },
+		"status": {}
+	}`
+	route := `{
+		"kind": "Route",
+		"metadata": { "name": "web", "annotations": { "openshift.io/host.generated": "%v" } },
+		"spec": { "host": "web.apps.example.com" }
+	}`
+	claim := `{ "kind": "PersistentVolumeClaim", "metadata": { "name": "data", "annotations": { "pv.kubernetes.io/bind-completed": "yes" } }, "spec": { "volumeName": "pv-1" } }`
+
+	cases := []struct {
+		name string
+		configure func( xr *XR )
+		fullName string
+		obj string
+		expected string
+	}{
+		{ "defaults", nil, KIND_SERVICE + "/db", service,
+			`{ "kind": "Service", "metadata": { "name": "db", "annotations": { "keep": "me" } }, "spec": { "clusterIP": "None", "ports": [ { "port": 5432 } ] } }` },
+		{ "generated host", nil, KIND_ROUTE + "/web", fmt.Sprintf( route, "true" ),
+			`{ "kind": "Route", "metadata": { "name": "web", "annotations": { "openshift.io/host.generated": "true" } }, "spec": {} }` },
+		{ "explicit host", nil, KIND_ROUTE + "/web", fmt.Sprintf( route, "false" ),
+			fmt.Sprintf( route, "false" ) },
+		{ "volume bindings", nil, KIND_PVC + "/data", claim,
+			`{ "kind": "PersistentVolumeClaim", "metadata": { "name": "data", "annotations": {} }, "spec": {} }` },
+		{ "preserved volume bindings", func( xr *XR ) {
+			xr.Spec.ImportRules.Transforms.Storage.PreserveVolumeBindings = true
+		}, KIND_PVC + "/data", claim, claim },
+		{ "keep", func( xr *XR ) {
+			xr.Spec.ExportRules.Transforms.Cleanup.Keep = []string{ "status", "spec.ports[*].nodePort" }
+		}, KIND_SERVICE + "/db", service,
+			`{ "kind": "Service", "metadata": { "name": "db", "annotations": { "keep": "me" } }, "spec": { "clusterIP": "None", "ports": [ { "port": 5432, "nodePort": 30432 } ] }, "status": {} }` },
+		{ "remove without defaults", func( xr *XR ) {
+			xr.Spec.ExportRules.Transforms.Cleanup.DisableDefaults = true
+			xr.Spec.ExportRules.Transforms.Cleanup.Remove = []CleanupRule{
+				{ Match: KIND_SERVICE, Path: `metadata.annotations["keep"]`, Except: []string{ "me" } },
+				{ Match: KIND_SERVICE + "/db", Path: "spec.clusterIP" },
+				{ Match: KIND_ROUTE, Path: "status" },
+			}
+		}, KIND_SERVICE + "/db", service,
+			`{ "kind": "Service", "metadata": { "name": "db", "uid": "u", "resourceVersion": "1", "annotations": { "kubectl.kubernetes.io/last-applied-configuration": "{}", "keep": "me" } }, "spec": { "ports": [ { "port": 5432, "nodePort": 30432 } ] }, "status": {} }` },
+	}
+	for _, tc := range cases {
+		xr := &XR{}
+		if tc.configure != nil {
+			tc.configure( xr )
+		}
+		c, err := NewCleanup( xr )
+		if err != nil {
+			t.Fatalf( "%v: %v", tc.name, err )
+		}
+		obj := parseTestObject( t, tc.obj )
+		c.Apply( tc.fullName, obj )
+		if expected := parseTestObject( t, tc.expected ); !reflect.DeepEqual( obj, expected ) {
+			t.Errorf( "%v:\n%v\nexpected\n%v", tc.name, obj, expected )
+		}
+	}
+
+	xr := &XR{}
+	xr.Spec.ExportRules.Transforms.Cleanup.Remove = []CleanupRule{ { Path: "spec..host" } }
+	if _, err := NewCleanup( xr ); err == nil {
+		t.Error( "expected an invalid cleanup path to be rejected" )
+	}
+}
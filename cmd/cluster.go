@@ -0,0 +1,337 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+	"context"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// How long Replace waits for a deleted object to disappear before recreating it.
+const replaceDeleteTimeout = 2 * time.Minute
+
+// Describes a failed API server interaction. The underlying error is typically
+// a k8s.io/apimachinery StatusError or NoKindMatchError and can be examined
+// with errors.As or helpers like IsNotFound.
+type ClusterError struct {
+	Op string
+	Resource string
+	Err error
+}
+
+func (e *ClusterError) Error() string {
+	return fmt.Sprintf( "Error performing %v on %v: %v", e.Op, e.Resource, e.Err )
+}
+
+func (e *ClusterError) Unwrap() error {
+	return e.Err
+}
+
+// Returns true if the error indicates the requested object does not exist.
+func IsNotFound( err error ) bool {
+	return apierrors.IsNotFound( err )
+}
+
+// Returns true if the error indicates the requested kind is not served by the cluster.
+func IsUnknownKind( err error ) bool {
+	return meta.IsNoMatchError( err )
+}
+
+// Cluster performs all interaction with the OpenShift API server using the
+// dynamic and discovery clients.
+type Cluster struct {
+	namespace string
+	dynamic dynamic.Interface
+	discovery discovery.DiscoveryInterface
+	mapper meta.RESTMapper
+	categories restmapper.CategoryExpander
+}
+
+var OC *Cluster
+
+// Selects the kubeconfig, context and namespace used to reach the cluster.
+// Empty fields fall back to the user's current kubeconfig settings, which
+// are never modified.
+type ClusterOptions struct {
+	Kubeconfig string
+	Context string
+	Namespace string
+}
+
+// Connects to the cluster described by the user's kubeconfig.
+func ConnectCluster( opts ClusterOptions ) (*Cluster, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = opts.Kubeconfig
+
+	overrides := &clientcmd.ConfigOverrides{ CurrentContext: opts.Context }
+	overrides.Context.Namespace = opts.Namespace
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig( loadingRules, overrides )
+
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf( "Unable to determine namespace from kubeconfig: %v", err )
+	}
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf( "Unable to load kubeconfig: %v", err )
+	}
+
+	dyn, err := dynamic.NewForConfig( restConfig )
+	if err != nil {
+		return nil, fmt.Errorf( "Unable to create dynamic client: %v", err )
+	}
+
+	disc, err := discovery.NewDiscoveryClientForConfig( restConfig )
+	if err != nil {
+		return nil, fmt.Errorf( "Unable to create discovery client: %v", err )
+	}
+
+	Out.Debug( "Connected to %v (context=%q, namespace=%v)", restConfig.Host, opts.Context, namespace )
+	return NewClusterForClients( namespace, dyn, disc ), nil
+}
+
+// Creates a Cluster from existing clients. Tests can supply fake clients
+// or clients configured against a fake API server.
+func NewClusterForClients( namespace string, dyn dynamic.Interface, disc discovery.DiscoveryInterface ) *Cluster {
+	cached := memory.NewMemCacheClient( disc )
+	return &Cluster{
+		namespace: namespace,
+		dynamic: dyn,
+		discovery: cached,
+		mapper: restmapper.NewShortcutExpander( restmapper.NewDeferredDiscoveryRESTMapper( cached ), cached, nil ),
+		categories: restmapper.NewDiscoveryCategoryExpander( cached ),
+	}
+}
+
+// Returns the namespace selected by --namespace or the user's kubeconfig.
+func (c *Cluster) Namespace() string {
+	return c.namespace
+}
+
+type resolvedResource struct {
+	gvr schema.GroupVersionResource
+	namespaced bool
+}
+
+// Resolves a resource name (plural, singular or short name, optionally
+// qualified with a group like "deployments.apps") to the resource preferred
+// by the cluster.
+func (c *Cluster) resolve( resource string ) (*resolvedResource, error) {
+	gvr, err := c.mapper.ResourceFor( schema.ParseGroupResource( resource ).WithVersion( "" ) )
+	if err != nil {
+		return nil, &ClusterError{ Op: "resolve", Resource: resource, Err: err }
+	}
+
+	gvk, err := c.mapper.KindFor( gvr )
+	if err != nil {
+		return nil, &ClusterError{ Op: "resolve", Resource: resource, Err: err }
+	}
+
+	mapping, err := c.mapper.RESTMapping( gvk.GroupKind(), gvk.Version )
+	if err != nil {
+		return nil, &ClusterError{ Op: "resolve", Resource: resource, Err: err }
+	}
+
+	return &resolvedResource{
+		gvr: mapping.Resource,
+		namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+	}, nil
+}
+
+// Resolves the apiVersion and kind of an object to its resource. Objects
+// exported from older OpenShift releases use the legacy v1 API for types
+// which now live in API groups; those are mapped by kind alone.
+func (c *Cluster) resolveObject( obj *unstructured.Unstructured ) (*resolvedResource, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping( gvk.GroupKind(), gvk.Version )
+
+	if err != nil && meta.IsNoMatchError( err ) && gvk.Group == "" {
+		Out.Debug( "Kind %v is not served by the legacy API; resolving by kind", gvk.Kind )
+		kinds, kerr := c.mapper.KindsFor( schema.GroupVersionResource{ Resource: strings.ToLower( gvk.Kind ) } )
+		if kerr == nil && len( kinds ) > 0 {
+			obj.SetAPIVersion( kinds[0].GroupVersion().String() )
+			mapping, err = c.mapper.RESTMapping( kinds[0].GroupKind(), kinds[0].Version )
+		}
+	}
+
+	if err != nil {
+		return nil, &ClusterError{ Op: "resolve", Resource: gvk.String(), Err: err }
+	}
+
+	return &resolvedResource{
+		gvr: mapping.Resource,
+		namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+	}, nil
+}
+
+func (c *Cluster) client( r *resolvedResource, namespace string ) dynamic.ResourceInterface {
+	if r.namespaced {
+		return c.dynamic.Resource( r.gvr ).Namespace( namespace )
+	}
+	return c.dynamic.Resource( r.gvr )
+}
+
+// Expands a resource name into the resources it represents. Categories
+// such as "all" expand to every resource which declares the category.
+func (c *Cluster) expand( resource string ) []string {
+	if grs, ok := c.categories.Expand( resource ); ok && len( grs ) > 0 {
+		var resources []string
+		for _, gr := range grs {
+			resources = append( resources, gr.String() )
+		}
+		return resources
+	}
+	return []string{ resource }
+}
+
+// Lists objects matching a kind[/name] entry in the namespace. kind may
+// be a category like "all". selector is an optional label selector.
+func (c *Cluster) List( namespace string, kindName string, selector string ) ([]unstructured.Unstructured, error) {
+	components := strings.SplitN( kindName, "/", 2 )
+
+	if len( components ) == 2 {
+		obj, err := c.Get( namespace, components[0], components[1] )
+		if err != nil {
+			return nil, err
+		}
+		return []unstructured.Unstructured{ *obj }, nil
+	}
+
+	var objs []unstructured.Unstructured
+	expanded := c.expand( components[0] )
+	for _, resource := range expanded {
+		r, err := c.resolve( resource )
+		if err != nil {
+			if len( expanded ) > 1 && IsUnknownKind( err ) {
+				continue
+			}
+			return nil, err
+		}
+
+		list, err := c.client( r, namespace ).List( context.TODO(), metav1.ListOptions{ LabelSelector: selector } )
+		if err != nil {
+			return nil, &ClusterError{ Op: "list", Resource: resource, Err: err }
+		}
+		objs = append( objs, list.Items... )
+	}
+	return objs, nil
+}
+
+// Returns the kind/name of each object matching a kind[/name] entry.
+func (c *Cluster) Names( namespace string, kindName string, selector string ) ([]string, error) {
+	objs, err := c.List( namespace, kindName, selector )
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, obj := range objs {
+		names = append( names, ObjectFullName( obj.Object ) )
+	}
+	return names, nil
+}
+
+func (c *Cluster) Get( namespace string, kind string, name string ) (*unstructured.Unstructured, error) {
+	r, err := c.resolve( kind )
+	if err != nil {
+		return nil, err
+	}
+	obj, err := c.client( r, namespace ).Get( context.TODO(), name, metav1.GetOptions{} )
+	if err != nil {
+		return nil, &ClusterError{ Op: "get", Resource: kind + "/" + name, Err: err }
+	}
+	return obj, nil
+}
+
+// Returns the definitions of objects matching a kind[/name] entry as served
+// by the cluster. Server populated fields are removed by the export cleanup
+// stage.
+func (c *Cluster) Export( namespace string, kindName string ) ([]map[string]interface{}, error) {
+	objs, err := c.List( namespace, kindName, "" )
+	if err != nil {
+		return nil, err
+	}
+
+	var exported []map[string]interface{}
+	for _, obj := range objs {
+		exported = append( exported, obj.UnstructuredContent() )
+	}
+	return exported, nil
+}
+
+// Deletes and recreates an object in the namespace, creating it if it does
+// not already exist. Dependents of the prior object are deleted with it.
+func (c *Cluster) Replace( namespace string, content map[string]interface{} ) error {
+	obj := &unstructured.Unstructured{ Object: content }
+	resource := obj.GetKind() + "/" + obj.GetName()
+
+	r, err := c.resolveObject( obj )
+	if err != nil {
+		return err
+	}
+
+	if r.namespaced {
+		obj.SetNamespace( namespace )
+	}
+
+	client := c.client( r, namespace )
+	propagation := metav1.DeletePropagationBackground
+	err = client.Delete( context.TODO(), obj.GetName(), metav1.DeleteOptions{ PropagationPolicy: &propagation } )
+
+	if err == nil {
+		// Wait for the prior object to be removed before recreating it
+		deadline := time.Now().Add( replaceDeleteTimeout )
+		for {
+			_, err = client.Get( context.TODO(), obj.GetName(), metav1.GetOptions{} )
+			if IsNotFound( err ) {
+				break
+			}
+			if time.Now().After( deadline ) {
+				return &ClusterError{ Op: "delete", Resource: resource, Err: fmt.Errorf( "Timed out waiting for deletion" ) }
+			}
+			time.Sleep( 500 * time.Millisecond )
+		}
+	} else if ! IsNotFound( err ) {
+		return &ClusterError{ Op: "delete", Resource: resource, Err: err }
+	}
+
+	_, err = client.Create( context.TODO(), obj, metav1.CreateOptions{} )
+	if err != nil {
+		return &ClusterError{ Op: "create", Resource: resource, Err: err }
+	}
+	return nil
+}
+
+// Deletes every object matching the kind entry and label selector in the namespace.
+func (c *Cluster) DeleteLabeled( namespace string, kind string, selector string ) error {
+	objs, err := c.List( namespace, kind, selector )
+	if err != nil {
+		return err
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	for i := range objs {
+		obj := &objs[i]
+		r, err := c.resolveObject( obj )
+		if err != nil {
+			return err
+		}
+		err = c.client( r, namespace ).Delete( context.TODO(), obj.GetName(), metav1.DeleteOptions{ PropagationPolicy: &propagation } )
+		if err != nil && ! IsNotFound( err ) {
+			return &ClusterError{ Op: "delete", Resource: obj.GetKind() + "/" + obj.GetName(), Err: err }
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"sort"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var testListKinds = map[schema.GroupVersionResource]string{
+	{ Version: "v1", Resource: "pods" }: "PodList",
+	{ Version: "v1", Resource: "services" }: "ServiceList",
+	{ Version: "v1", Resource: "configmaps" }: "ConfigMapList",
+	{ Group: "apps", Version: "v1", Resource: "deployments" }: "DeploymentList",
+}
+
+var testResources = []*metav1.APIResourceList{
+	{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{ Name: "pods", SingularName: "pod", Kind: "Pod", Namespaced: true, ShortNames: []string{ "po" }, Categories: []string{ "all" }, Verbs: []string{ "list", "get", "create", "delete" } },
+			{ Name: "services", SingularName: "service", Kind: "Service", Namespaced: true, ShortNames: []string{ "svc" }, Categories: []string{ "all" }, Verbs: []string{ "list", "get", "create", "delete" } },
+			{ Name: "configmaps", SingularName: "configmap", Kind: "ConfigMap", Namespaced: true, ShortNames: []string{ "cm" }, Verbs: []string{ "list", "get", "create", "delete" } },
+		},
+	},
+	{
+		GroupVersion: "apps/v1",
+		APIResources: []metav1.APIResource{
+			{ Name: "deployments", SingularName: "deployment", Kind: "Deployment", Namespaced: true, ShortNames: []string{ "deploy" }, Categories: []string{ "all" }, Verbs: []string{ "list", "get", "create", "delete" } },
+		},
+	},
+}
+
+func testObject( apiVersion string, kind string, namespace string, name string, labels map[string]interface{} ) *unstructured.Unstructured {
+	metadata := map[string]interface{}{ "name": name, "namespace": namespace }
+	if labels != nil {
+		metadata[ "labels" ] = labels
+	}
+	return &unstructured.Unstructured{ Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind": kind,
+		"metadata": metadata,
+	}}
+}
+
+// Creates a Cluster backed by fake clients and makes it the current
+// cluster. The resource type cache is written to a temporary directory.
+func newTestCluster( t *testing.T, objs... runtime.Object ) *Cluster {
+	return newTestClusterWithResources( t, testResources, objs... )
+}
+
+// Like newTestCluster, but discovery reports the given resource types.
+func newTestClusterWithResources( t *testing.T, resources []*metav1.APIResourceList, objs... runtime.Object ) *Cluster {
+	t.Setenv( "HOME", t.TempDir() )
+	t.Setenv( "XDG_CACHE_HOME", t.TempDir() )
+
+	disc := &discoveryfake.FakeDiscovery{ Fake: &clienttesting.Fake{ Resources: resources } }
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds( runtime.NewScheme(), testListKinds, objs... )
+
+	prior, priorKinds := OC, kinds
+	OC = NewClusterForClients( "demo", dyn, disc )
+	t.Cleanup( func() { OC, kinds = prior, priorKinds } )
+	return OC
+}
+
+// Resolves kinds with the built-in resource types, as when no cluster is
+// reachable and nothing is cached.
+func useBuiltinKinds( t *testing.T ) {
+	prior, priorKinds := OC, kinds
+	OC, kinds = nil, &KindResolver{ types: builtinResourceTypes }
+	t.Cleanup( func() { OC, kinds = prior, priorKinds } )
+}
+
+func sortedNames( t *testing.T, c *Cluster, kindName string, selector string ) []string {
+	names, err := c.Names( "demo", kindName, selector )
+	if err != nil {
+		t.Fatalf( "Names(%v): %v", kindName, err )
+	}
+	sort.Strings( names )
+	return names
+}
+
+func TestClusterGet( t *testing.T ) {
+	c := newTestCluster( t, testObject( "v1", "ConfigMap", "demo", "settings", nil ) )
+
+	for _, kind := range []string{ "configmaps", "configmap", "cm" } {
+		obj, err := c.Get( "demo", kind, "settings" )
+		if err != nil {
+			t.Fatalf( "Get(%v): %v", kind, err )
+		}
+		if obj.GetName() != "settings" {
+			t.Errorf( "Get(%v) returned %v", kind, obj.GetName() )
+		}
+	}
+
+	_, err := c.Get( "demo", "configmaps", "missing" )
+	if !IsNotFound( err ) {
+		t.Errorf( "expected a not found error, got %v", err )
+	}
+
+	_, err = c.Get( "demo", "nosuchkind", "settings" )
+	if !IsUnknownKind( err ) {
+		t.Errorf( "expected an unknown kind error, got %v", err )
+	}
+}
+
+func TestClusterNames( t *testing.T ) {
+	app := map[string]interface{}{ "app": "web" }
+	c := newTestCluster( t,
+		testObject( "v1", "Pod", "demo", "web-1", app ),
+		testObject( "v1", "Pod", "demo", "other", nil ),
+		testObject( "v1", "Service", "demo", "web", app ),
+		testObject( "v1", "ConfigMap", "demo", "web", app ),
+		testObject( "apps/v1", "Deployment", "demo", "web", app ),
+		testObject( "apps/v1", "Deployment", "elsewhere", "web", app ),
+	)
+
+	cases := []struct {
+		kindName string
+		selector string
+		expected []string
+	}{
+		{ "configmaps", "", []string{ "configmaps/web" } },
+		{ "deploy", "", []string{ "deployments.apps/web" } },
+		{ "pods/web-1", "", []string{ "pods/web-1" } },
+		{ "pods", "app=web", []string{ "pods/web-1" } },
+		// The "all" category covers pods, services and deployments but not configmaps
+		{ "all", "", []string{ "deployments.apps/web", "pods/other", "pods/web-1", "services/web" } },
+		{ "all", "app=web", []string{ "deployments.apps/web", "pods/web-1", "services/web" } },
+	}
+
+	for _, tc := range cases {
+		names := sortedNames( t, c, tc.kindName, tc.selector )
+		if !reflect.DeepEqual( names, tc.expected ) {
+			t.Errorf( "Names(%v, %q) = %v, expected %v", tc.kindName, tc.selector, names, tc.expected )
+		}
+	}
+}
+
+func TestClusterReplace( t *testing.T ) {
+	existing := testObject( "v1", "ConfigMap", "demo", "settings", nil )
+	existing.Object[ "data" ] = map[string]interface{}{ "key": "old" }
+	c := newTestCluster( t, existing )
+
+	replacement := testObject( "v1", "ConfigMap", "source", "settings", nil ).Object
+	replacement[ "data" ] = map[string]interface{}{ "key": "new" }
+	err := c.Replace( "demo", replacement )
+	if err != nil {
+		t.Fatalf( "Replace: %v", err )
+	}
+
+	obj, err := c.Get( "demo", "configmaps", "settings" )
+	if err != nil {
+		t.Fatalf( "Get: %v", err )
+	}
+	if v, _, _ := unstructured.NestedString( obj.Object, "data", "key" ); v != "new" {
+		t.Errorf( "replaced object has data.key %q, expected new", v )
+	}
+
+	// Objects which do not exist are created in the target namespace
+	err = c.Replace( "demo", testObject( "apps/v1", "Deployment", "source", "web", nil ).Object )
+	if err != nil {
+		t.Fatalf( "Replace (create): %v", err )
+	}
+	obj, err = c.Get( "demo", "deployments", "web" )
+	if err != nil {
+		t.Fatalf( "Get: %v", err )
+	}
+	if obj.GetNamespace() != "demo" {
+		t.Errorf( "created object is in namespace %v, expected demo", obj.GetNamespace() )
+	}
+}
+
+func TestClusterDeleteLabeled( t *testing.T ) {
+	labels := map[string]interface{}{ LABEL_REPOSITORY: "xr" }
+	c := newTestCluster( t,
+		testObject( "v1", "Pod", "demo", "labeled", labels ),
+		testObject( "v1", "Pod", "demo", "unlabeled", nil ),
+		testObject( "v1", "Service", "demo", "labeled", labels ),
+		testObject( "v1", "ConfigMap", "demo", "labeled", labels ),
+		testObject( "apps/v1", "Deployment", "demo", "labeled", labels ),
+		testObject( "apps/v1", "Deployment", "elsewhere", "labeled", labels ),
+	)
+
+	err := c.DeleteLabeled( "demo", "all", LABEL_REPOSITORY + "=xr" )
+	if err != nil {
+		t.Fatalf( "DeleteLabeled: %v", err )
+	}
+
+	// configmaps are not in the "all" category
+	expected := []string{ "configmaps/labeled", "pods/unlabeled" }
+	var names []string
+	for _, kind := range []string{ "pods", "services", "configmaps", "deployments" } {
+		names = append( names, sortedNames( t, c, kind, "" )... )
+	}
+	sort.Strings( names )
+	if !reflect.DeepEqual( names, expected ) {
+		t.Errorf( "remaining objects %v, expected %v", names, expected )
+	}
+
+	if _, err := c.Get( "elsewhere", "deployments", "labeled" ); err != nil {
+		t.Errorf( "object in another namespace was deleted: %v", err )
+	}
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"os"
+	"fmt"
+	"regexp"
+	"strings"
+	"io/ioutil"
+	"path/filepath"
+	"encoding/json"
+	"encoding/base64"
+)
+
+const (
+	ENCRYPTION_AGE = "age"
+	ENCRYPTION_OPENPGP = "openpgp"
+
+	// Holds the private key itself, as an alternative to --decryption-key
+	ENV_DECRYPTION_KEY = "XRUTIL_DECRYPTION_KEY"
+)
+
+// Encrypted values are stored as ENC[<format>,<base64 ciphertext>] so that
+// secret names, labels and keys remain readable in diffs.
+var encryptedValuePattern = regexp.MustCompile( `^ENC\[(age|openpgp),([A-Za-z0-9+/=]+)\]$` )
+
+// The secret fields whose values are encrypted.
+var encryptedSecretFields = []string{ "data", "stringData" }
+
+func IsEncryptedValue( v string ) bool {
+	return encryptedValuePattern.MatchString( v )
+}
+
+// Encrypts secret values for the recipients listed in the XR.
+type SecretEncryptor struct {
+	format string
+	recipients []string
+}
+
+// Returns nil if the XR does not request encryption.
+func NewSecretEncryptor( xr *XR ) (*SecretEncryptor, error) {
+	config := xr.Spec.Encryption
+	if config.Format == "" && len( config.Recipients ) == 0 {
+		return nil, nil
+	}
+	if config.Format != ENCRYPTION_AGE && config.Format != ENCRYPTION_OPENPGP {
+		return nil, fmt.Errorf( "Unsupported encryption format (must be %v or %v): %q", ENCRYPTION_AGE, ENCRYPTION_OPENPGP, config.Format )
+	}
+	if len( config.Recipients ) == 0 {
+		return nil, fmt.Errorf( "Encryption requires at least one recipient" )
+	}
+	return &SecretEncryptor{ format: config.Format, recipients: config.Recipients }, nil
+}
+
+func (e *SecretEncryptor) encrypt( plaintext string ) (string, error) {
+	var args []string
+	var command string
+
+	switch e.format {
+	case ENCRYPTION_AGE:
+		command = "age"
+		args = []string{ "--encrypt" }
+		for _, r := range e.recipients {
+			args = append( args, "--recipient", r )
+		}
+	case ENCRYPTION_OPENPGP:
+		command = "gpg"
+		args = []string{ "--batch", "--yes", "--trust-model", "always", "--encrypt" }
+		for _, r := range e.recipients {
+			// Recipients are key IDs in the user's keyring or public key files
+			if _, err := os.Stat( r ); err == nil {
+				args = append( args, "--recipient-file", r )
+			} else {
+				args = append( args, "--recipient", r )
+			}
+		}
+	}
+
+	ciphertext, se, err := ExecInput( []byte( plaintext ), command, args... )
+	if err != nil {
+		return "", fmt.Errorf( "Error encrypting with %v [%v]: %v", command, err, se )
+	}
+	return "ENC[" + e.format + "," + base64.StdEncoding.EncodeToString( ciphertext ) + "]", nil
+}
+
+// Encrypts the data and stringData values of a secret in place. Values
+// which are already encrypted are left alone.
+func (e *SecretEncryptor) EncryptObject( obj map[string]interface{} ) error {
+	for _, field := range encryptedSecretFields {
+		values, _ := obj[ field ].(map[string]interface{})
+		for key, v := range values {
+			s, ok := v.(string)
+			if !ok || IsEncryptedValue( s ) {
+				continue
+			}
+			encrypted, err := e.encrypt( s )
+			if err != nil {
+				return fmt.Errorf( "%v.%v: %v", field, key, err )
+			}
+			values[ key ] = encrypted
+		}
+	}
+	return nil
+}
+
+// Decrypts secret values with a private key: an age identity file or an
+// armored OpenPGP private key.
+type SecretDecryptor struct {
+	workDir string
+	keyFile string
+	gnupgHome string // set for OpenPGP keys
+}
+
+// Creates a decryptor from the key file, or from ENV_DECRYPTION_KEY when
+// keyFile is empty. Returns nil if neither supplies a key.
+func NewSecretDecryptor( keyFile string ) (*SecretDecryptor, error) {
+	var key []byte
+	if keyFile != "" {
+		var err error
+		key, err = ioutil.ReadFile( keyFile )
+		if err != nil {
+			return nil, fmt.Errorf( "Unable to read decryption key (%v): %v", keyFile, err )
+		}
+	} else if env := os.Getenv( ENV_DECRYPTION_KEY ); env != "" {
+		key = []byte( env )
+	} else {
+		return nil, nil
+	}
+
+	workDir, err := ioutil.TempDir( "", "xrutil-key" )
+	if err != nil {
+		return nil, fmt.Errorf( "Unable to create key directory: %v", err )
+	}
+	d := &SecretDecryptor{ workDir: workDir, keyFile: filepath.Join( workDir, "key" ) }
+
+	err = ioutil.WriteFile( d.keyFile, key, 0600 )
+	if err != nil {
+		d.Close()
+		return nil, fmt.Errorf( "Unable to write decryption key: %v", err )
+	}
+
+	if strings.Contains( string( key ), "BEGIN PGP PRIVATE KEY BLOCK" ) {
+		// Import into a private keyring so the user's is not modified
+		d.gnupgHome = filepath.Join( workDir, "gnupg" )
+		err = os.Mkdir( d.gnupgHome, 0700 )
+		if err == nil {
+			var se string
+			_, se, err = Exec( "gpg", "--batch", "--homedir", d.gnupgHome, "--import", d.keyFile )
+			if err != nil {
+				err = fmt.Errorf( "%v: %v", err, se )
+			}
+		}
+		if err != nil {
+			d.Close()
+			return nil, fmt.Errorf( "Unable to import OpenPGP decryption key: %v", err )
+		}
+	}
+
+	return d, nil
+}
+
+func (d *SecretDecryptor) Close() {
+	os.RemoveAll( d.workDir )
+}
+
+func (d *SecretDecryptor) decrypt( value string ) (string, error) {
+	m := encryptedValuePattern.FindStringSubmatch( value )
+	ciphertext, err := base64.StdEncoding.DecodeString( m[2] )
+	if err != nil {
+		return "", fmt.Errorf( "Invalid encrypted value: %v", err )
+	}
+
+	var plaintext []byte
+	var se string
+	switch m[1] {
+	case ENCRYPTION_AGE:
+		if d.gnupgHome != "" {
+			return "", fmt.Errorf( "Value is encrypted with age but the decryption key is an OpenPGP key" )
+		}
+		plaintext, se, err = ExecInput( ciphertext, "age", "--decrypt", "--identity", d.keyFile )
+	case ENCRYPTION_OPENPGP:
+		if d.gnupgHome == "" {
+			return "", fmt.Errorf( "Value is encrypted with OpenPGP but the decryption key is not an OpenPGP private key" )
+		}
+		plaintext, se, err = ExecInput( ciphertext, "gpg", "--batch", "--quiet", "--homedir", d.gnupgHome, "--decrypt" )
+	}
+	if err != nil {
+		return "", fmt.Errorf( "Error decrypting with %v [%v]: %v", m[1], err, se )
+	}
+	return string( plaintext ), nil
+}
+
+// Decrypts the encrypted data and stringData values of an object in place.
+// Returns the number of values decrypted.
+func (d *SecretDecryptor) DecryptObject( obj map[string]interface{} ) (int, error) {
+	count := 0
+	for _, field := range encryptedSecretFields {
+		values, _ := obj[ field ].(map[string]interface{})
+		for key, v := range values {
+			s, ok := v.(string)
+			if !ok || ! IsEncryptedValue( s ) {
+				continue
+			}
+			plaintext, err := d.decrypt( s )
+			if err != nil {
+				return count, fmt.Errorf( "%v.%v: %v", field, key, err )
+			}
+			values[ key ] = plaintext
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Returns an object file's content with its secret values decrypted, for
+// comparing versions of a secret whose ciphertext differs.
+func (d *SecretDecryptor) DecryptText( content string ) (string, error) {
+	var obj map[string]interface{}
+	err := json.Unmarshal( []byte( content ), &obj )
+	if err != nil {
+		return "", err
+	}
+	_, err = d.DecryptObject( obj )
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal( obj )
+	return string( data ), err
+}
+
+// Returns true if an object contains encrypted values.
+func HasEncryptedValues( obj map[string]interface{} ) bool {
+	for _, field := range encryptedSecretFields {
+		values, _ := obj[ field ].(map[string]interface{})
+		for _, v := range values {
+			if s, ok := v.(string); ok && IsEncryptedValue( s ) {
+				return true
+			}
+		}
+	}
+	return false
+}
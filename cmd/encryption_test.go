@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+	"path/filepath"
+)
+
+func TestIsEncryptedValue( t *testing.T ) {
+	cases := []struct {
+		value string
+		expected bool
+	}{
+		{ "ENC[age,YWdl]", true },
+		{ "ENC[openpgp,b3Blbi9wZ3A=]", true },
+		{ "ENC[rot13,YWdl]", false },
+		{ "ENC[age,]", false },
+		{ "ENC[age,YWdl] ", false },
+		{ "cGFzc3dvcmQ=", false },
+	}
+	for _, tc := range cases {
+		if IsEncryptedValue( tc.value ) != tc.expected {
+			t.Errorf( "IsEncryptedValue(%q) != %v", tc.value, tc.expected )
+		}
+	}
+}
+
+func TestNewSecretEncryptor( t *testing.T ) {
+	cases := []struct {
+		format string
+		recipients []string
+		valid bool
+	}{
+		{ "", nil, true }, // encryption not requested
+		{ ENCRYPTION_AGE, []string{ "age1example" }, true },
+		{ ENCRYPTION_OPENPGP, []string{ "ops@example.com" }, true },
+		{ "rot13", []string{ "ops@example.com" }, false },
+		{ ENCRYPTION_AGE, nil, false },
+		{ "", []string{ "age1example" }, false },
+	}
+	for _, tc := range cases {
+		xr := &XR{}
+		xr.Spec.Encryption.Format = tc.format
+		xr.Spec.Encryption.Recipients = tc.recipients
+		_, err := NewSecretEncryptor( xr )
+		if ( err == nil ) != tc.valid {
+			t.Errorf( "NewSecretEncryptor(%q, %v): error %v", tc.format, tc.recipients, err )
+		}
+	}
+}
+
+// Generates an OpenPGP key without a passphrase in a temporary keyring and
+// returns its public and armored private key files.
+func newTestOpenPGPKey( t *testing.T ) (string, string) {
+	if _, err := exec.LookPath( "gpg" ); err != nil {
+		t.Skip( "gpg is not installed" )
+	}
+	dir := t.TempDir()
+	home := filepath.Join( dir, "gnupg" )
+	publicKey := filepath.Join( dir, "public.asc" )
+	privateKey := filepath.Join( dir, "private.asc" )
+	if err := os.Mkdir( home, 0700 ); err != nil {
+		t.Fatal( err )
+	}
+	t.Cleanup( func() { exec.Command( "gpgconf", "--homedir", home, "--kill", "gpg-agent" ).Run() } )
+	for _, args := range [][]string{
+		{ "--quick-generate-key", "--passphrase", "", "xrutil-test@example.com", "default", "default", "never" },
+		{ "--armor", "--output", publicKey, "--export", "xrutil-test@example.com" },
+		{ "--armor", "--output", privateKey, "--export-secret-keys", "xrutil-test@example.com" },
+	} {
+		args = append( []string{ "--batch", "--homedir", home, "--pinentry-mode", "loopback" }, args... )
+		if out, err := exec.Command( "gpg", args... ).CombinedOutput(); err != nil {
+			t.Fatalf( "gpg %v: %v: %s", args, err, out )
+		}
+	}
+	return publicKey, privateKey
+}
+
+func TestSecretEncryptionRoundTrip( t *testing.T ) {
+	publicKey, privateKey := newTestOpenPGPKey( t )
+	t.Setenv( "GNUPGHOME", t.TempDir() )
+	t.Setenv( ENV_DECRYPTION_KEY, "" )
+
+	xr := &XR{}
+	xr.Spec.Encryption.Format = ENCRYPTION_OPENPGP
+	xr.Spec.Encryption.Recipients = []string{ publicKey }
+	encryptor, err := NewSecretEncryptor( xr )
+	if err != nil {
+		t.Fatal( err )
+	}
+
+	original := `{ "kind": "Secret", "metadata": { "name": "db" }, "data": { "password": "c2VjcmV0" }, "stringData": { "user": "admin" } }`
+	obj := parseTestObject( t, original )
+	if err := encryptor.EncryptObject( obj ); err != nil {
+		t.Fatal( err )
+	}
+	if !HasEncryptedValues( obj ) {
+		t.Fatalf( "values were not encrypted: %v", obj )
+	}
+	for _, path := range [][]string{ { "data", "password" }, { "stringData", "user" } } {
+		if v, _ := GetJSONPath( obj, path... ).(string); !IsEncryptedValue( v ) {
+			t.Errorf( "%v is not encrypted: %v", path, v )
+		}
+	}
+	if name := GetJSONPath( obj, "metadata", "name" ); name != "db" {
+		t.Errorf( "metadata was modified: %v", name )
+	}
+
+	decryptor, err := NewSecretDecryptor( privateKey )
+	if err != nil {
+		t.Fatal( err )
+	}
+	defer decryptor.Close()
+
+	count, err := decryptor.DecryptObject( obj )
+	if err != nil {
+		t.Fatal( err )
+	}
+	if count != 2 {
+		t.Errorf( "decrypted %v values, expected 2", count )
+	}
+	if expected := parseTestObject( t, original ); !reflect.DeepEqual( obj, expected ) {
+		t.Errorf( "round trip = %v, expected %v", obj, expected )
+	}
+
+	// A value encrypted with another format cannot be decrypted with the key
+	obj = parseTestObject( t, `{ "data": { "password": "ENC[age,YWdl]" } }` )
+	if _, err := decryptor.DecryptObject( obj ); err == nil {
+		t.Error( "expected an age value to be rejected by an OpenPGP key" )
+	}
+}
+
+func TestNewSecretDecryptorWithoutKey( t *testing.T ) {
+	t.Setenv( ENV_DECRYPTION_KEY, "" )
+	d, err := NewSecretDecryptor( "" )
+	if d != nil || err != nil {
+		t.Errorf( "NewSecretDecryptor without a key = %v, %v", d, err )
+	}
+	if _, err := NewSecretDecryptor( filepath.Join( t.TempDir(), "missing" ) ); err == nil {
+		t.Error( "expected a missing key file to be rejected" )
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"github.com/spf13/cobra"
+	"path"
 	"path/filepath"
 	"strings"
 	"fmt"
 	"time"
+	"regexp"
 )
 
 type ExportConfig struct {
@@ -16,19 +18,126 @@ type ExportConfig struct {
 	version string
 	message string
 	overwrite bool
+	signingKey string
+	signingFormat string
+	reviewBranch string
+	decryptionKey string
+	cluster ClusterOptions
+	dryRun bool
+
+	// Set by runExport so that callers like sync can carry them forward
+	generatedTag string
+	keepStaged bool
+	stagedStore ObjectStore
 }
 
 var _exportConfig ExportConfig
 
+// Resource types skipped by include "*" unless exportRules.ignore is set.
+// Entries suffixed with ":owned" only skip objects with a controller owner
+// since the owner recreates them. Image stream tags are exported as part of
+// their image streams.
+const DEFAULT_EXPORT_IGNORE = "events, events.events.k8s.io, endpoints, endpointslices.discovery.k8s.io, " +
+	"imagestreamtags.image.openshift.io, pods:owned, replicasets.apps:owned, replicationcontrollers:owned, " +
+	"controllerrevisions.apps:owned, jobs.batch:owned, builds.build.openshift.io:owned"
+
+type exportIgnoreList struct {
+	kinds map[string]struct{}
+	owned map[string]struct{}
+}
+
+func parseExportIgnoreList( list string ) *exportIgnoreList {
+	il := &exportIgnoreList{ kinds: map[string]struct{}{}, owned: map[string]struct{}{} }
+	for _, entry := range strings.Split( list, "," ) {
+		entry = strings.TrimSpace( entry )
+		if entry == "" {
+			continue
+		}
+		if strings.HasSuffix( entry, ":owned" ) {
+			il.owned[ NormalizeType( strings.TrimSuffix( entry, ":owned" ) ) ] = struct{}{}
+		} else {
+			il.kinds[ NormalizeType( entry ) ] = struct{}{}
+		}
+	}
+	return il
+}
+
+func (il *exportIgnoreList) ignoresKind( kind string ) bool {
+	_, ok := il.kinds[ kind ]
+	return ok
+}
+
+// Returns true if the object is of an ":owned" kind and has a controller.
+func (il *exportIgnoreList) ignoresObject( kind string, obj map[string]interface{} ) bool {
+	if _, ok := il.owned[ kind ]; !ok {
+		return false
+	}
+	owners, _ := GetJSONPath( obj, "metadata", "ownerReferences" ).([]interface{})
+	for _, owner := range owners {
+		if controller, _ := GetJSONPath( owner, "controller" ).(bool); controller {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the exportable resource types matched by an include entry of "*"
+// or by a pattern whose kind is not literal, less ignored types. Regular
+// expressions match every type; their objects are filtered later.
+func exportableKinds( entry string, ignore *exportIgnoreList ) ([]string, error) {
+	types, err := Kinds().ExportableTypes()
+	if err != nil {
+		return nil, err
+	}
+	var kindNames []string
+	for _, rt := range types {
+		if entry != "*" && ! strings.HasPrefix( entry, KIND_NAME_REGEX_PREFIX ) {
+			if ok, _ := path.Match( strings.SplitN( entry, "/", 2 )[0], rt.Name() ); !ok {
+				continue
+			}
+		}
+		if ignore.ignoresKind( rt.Name() ) {
+			Out.Debug( "Ignoring resource type: %v", rt.Name() )
+			continue
+		}
+		kindNames = append( kindNames, rt.Name() )
+	}
+	return kindNames, nil
+}
+
 // exportCmd represents the export command
 var exportCmd = &cobra.Command{
 	Use:   "export <object-repository-json-file>",
 	Short: "Exports a selection of OpenShift oject definitions",
 	Run: func( cmd *cobra.Command, args []string) {
+		_exportConfig.cluster = clusterOptionsFromFlags()
 		runExport( &_exportConfig, cmd, args )
 	},
 }
 
+// Returns the most recent generated tag referenced by the object files
+// in dir, or "" if none is.
+func findGeneratedTag( dir string, pattern *regexp.Regexp ) string {
+	latest := ""
+	filepath.Walk( dir, func( path string, info os.FileInfo, err error ) error {
+		if err != nil || ! info.Mode().IsRegular() {
+			return nil
+		}
+		content, err := ioutil.ReadFile( path )
+		if err != nil {
+			return nil
+		}
+		for _, tag := range pattern.FindAllString( string( content ), -1 ) {
+			// Timestamps have the same number of digits, so they sort as strings
+			if tag > latest {
+				latest = tag
+			}
+		}
+		return nil
+	})
+	return latest
+}
+
 func runExport(config *ExportConfig, cmd *cobra.Command, args []string) {
 
 	if len( args ) == 0 {
@@ -52,68 +161,62 @@ func runExport(config *ExportConfig, cmd *cobra.Command, args []string) {
 		}
 	}
 
-	git, err := PrepGitDir( xr )
-
-	if err != nil {
-		Out.Error( "Error initializing git repository: %v", err )
-		os.Exit(1)
+	if config.signingKey == "" {
+		config.signingKey = xr.Spec.Git.Signing.Key
 	}
 
-	if persist,_ := RootCmd.PersistentFlags().GetBool("preserve-git"); persist {
-		Out.Warn( "The working git directory will not be removed: %v", git.repoDir )
-	} else {
-		defer os.RemoveAll( git.repoDir )
+	if config.signingFormat == "" {
+		config.signingFormat = xr.Spec.Git.Signing.Format
 	}
 
-	branchName := xr.Spec.Git.Branch.Prefix + config.version
+	preserve,_ := RootCmd.PersistentFlags().GetBool("preserve-git")
 
-	// See if branch name already exists
-	_,se,err := git.Exec( "checkout", branchName  )
+	store, err := OpenObjectStore( xr, StoreOptions{
+		Overwrite: config.overwrite,
+		ReviewBranch: config.reviewBranch,
+		SigningKey: config.signingKey,
+		SigningFormat: config.signingFormat,
+		Preserve: preserve,
+	})
 
-	if err == nil  && !config.overwrite {
-		Out.Error( "Branch already exists and --overwrite was not specified (%v) [%v]: %v", branchName, err, se )
+	if err != nil {
+		Out.Error( "Error initializing object storage: %v", err )
 		os.Exit(1)
 	}
-
-	_,se,err = git.Exec( "branch", branchName, xr.Spec.Git.Branch.BaseRef )
-	if err != nil {
-		Out.Warn( "Error while creating branch (%v) [%v]: %v", branchName, err, se )
+	if config.keepStaged {
+		config.stagedStore = store
+	} else {
+		defer store.Close()
 	}
 
-	_,se,err = git.Exec( "checkout", branchName )
-
+	err = store.Stage( config.version )
 	if err != nil {
-		Out.Error( "Error checking out git branch (%v) [%v]: %v", branchName, err, se )
+		Out.Error( "Error preparing version %v for export: %v", config.version, err )
 		os.Exit(1)
 	}
 
-	headCommitId,se,err := git.Exec( "rev-parse", "HEAD" ) // Store the current HEAD commit ID
-
-	if err != nil {
-		Out.Error( "Unable to determine HEAD commit id for branch (%v) [%v]: %v", branchName, err, se )
-		os.Exit(1)
+	if config.cluster.Kubeconfig == "" {
+		config.cluster.Kubeconfig = xr.Spec.ExportRules.Kubeconfig
 	}
 
-	_,se,err = git.Exec( "reset", "--hard", xr.Spec.Git.Branch.BaseRef )
-
-	if err != nil {
-		Out.Error( "Error hard reseting git branch (%v) to (%v) [%v]: %v", branchName, xr.Spec.Git.Branch.BaseRef, err, se )
-		os.Exit(1)
+	if config.cluster.Context == "" {
+		config.cluster.Context = xr.Spec.ExportRules.Context
 	}
 
-	_,se,err = git.Exec( "reset", "--soft", headCommitId )
+	if config.cluster.Namespace == "" {
+		config.cluster.Namespace = xr.Spec.ExportRules.Namespace
+	}
 
+	OC, err = ConnectCluster( config.cluster )
 	if err != nil {
-		Out.Error( "Error soft reseting git branch (%v) to (%v) [%v]: %v", branchName, headCommitId, err, se )
+		Out.Error( "Unable to connect to cluster: %v", err )
 		os.Exit(1)
 	}
 
-	projectName, err := OC.Project()
-	if err != nil {
-		Out.Error( "Unable to obtain current project name: %v", err )
-	}
+	projectName := OC.Namespace()
 
 	generatedTag := fmt.Sprintf( ":%v_%v", config.version, makeTimestamp() )
+	config.generatedTag = generatedTag
 
 	var selectedNames map[string]struct{} // nil is effectively selecting all
 
@@ -129,13 +232,13 @@ func runExport(config *ExportConfig, cmd *cobra.Command, args []string) {
 				Out.Error( "Selectors/Namespace is not currently supported")
 				os.Exit(1)
 			}
-			so, se, err := OC.Exec( "get", "all",  "-o=name", "-l", strings.Join( selector.MatchLabels, "," ) )
+			names, err := OC.Names( projectName, "all", strings.Join( selector.MatchLabels, "," ) )
 			if err != nil {
-				Out.Error( "Error gathering selection [%v]: %v", err, se )
+				Out.Error( "Error gathering selection: %v", err )
 				os.Exit(1)
 			}
-			for _,selectedName :=  range strings.Split( so, "\n" ) {
-				selectedNames[ NormalizeType( selectedName ) ] = struct{}{}
+			for _,selectedName :=  range names {
+				selectedNames[ selectedName ] = struct{}{}
 			}
 		}
 	}
@@ -144,34 +247,125 @@ func runExport(config *ExportConfig, cmd *cobra.Command, args []string) {
 		xr.Spec.ExportRules.Include = "all"
 	}
 
-	include := ToKindNameList(xr.Spec.ExportRules.Include)
-	for _, i := range include {
+	ignoreList := DEFAULT_EXPORT_IGNORE
+	if xr.Spec.ExportRules.Ignore != nil {
+		ignoreList = *xr.Spec.ExportRules.Ignore
+	}
+	ignore := parseExportIgnoreList( ignoreList )
+
+	// Kinds enumerated by "*" or by a pattern's kind are subject to the
+	// ignore list. Objects of kinds listed only because of a pattern must
+	// be selected by one of the kind's patterns.
+	var include []string
+	wildcardKinds := map[string]struct{}{}
+	kindPatterns := map[string][]string{}
+	unfilteredKinds := map[string]struct{}{}
+	literalNames := map[string]struct{}{}
+	for _, i := range ToKindNameList(xr.Spec.ExportRules.Include) {
+		if i != "*" && ! IsKindNamePattern( i ) {
+			include = append( include, i )
+			if strings.Contains( i, "/" ) {
+				literalNames[ i ] = struct{}{}
+			} else {
+				unfilteredKinds[ i ] = struct{}{}
+			}
+			continue
+		}
 
-		exactFlag := "--exact=false"
-		if strings.HasPrefix( i, "secrets/" ) || i == "secrets" {
-			exactFlag = "--exact=true"
+		if kind, ok := KindNamePatternKind( i ); ok {
+			include = append( include, kind )
+			kindPatterns[ kind ] = append( kindPatterns[ kind ], i )
+			continue
 		}
 
-		so, se, err := OC.Exec("export", i, "-o=json", exactFlag, "--as-template=x")
+		kindNames, err := exportableKinds( i, ignore )
 		if err != nil {
-			Out.Warn( "Unable to export object definitions %v [%v]: %v", i, err, se )
+			Out.Error( "Unable to enumerate resource types for include %q: %v", i, err )
+			os.Exit(1)
+		}
+		for _, kind := range kindNames {
+			include = append( include, kind )
+			wildcardKinds[ kind ] = struct{}{}
+			if i == "*" {
+				unfilteredKinds[ kind ] = struct{}{}
+			} else {
+				kindPatterns[ kind ] = append( kindPatterns[ kind ], i )
+			}
 		}
+	}
+
+	secretsMode, err := SecretsMode( xr )
+	if err != nil {
+		Out.Error( "%v", err )
+		os.Exit(1)
+	}
+
+	imageTriggers := xr.Spec.ExportRules.Transforms.ImageTriggers
+	switch imageTriggers {
+	case "":
+		imageTriggers = IMAGE_TRIGGERS_STRIP
+	case IMAGE_TRIGGERS_STRIP, IMAGE_TRIGGERS_REWRITE:
+	default:
+		Out.Error( "Invalid imageTriggers mode (must be %v or %v): %q", IMAGE_TRIGGERS_STRIP, IMAGE_TRIGGERS_REWRITE, imageTriggers )
+		os.Exit(1)
+	}
+	images := NewImageRewriter( xr, projectName, generatedTag )
+
+	encryptor, err := NewSecretEncryptor( xr )
+	if err != nil {
+		Out.Error( "Invalid encryption configuration: %v", err )
+		os.Exit(1)
+	}
+
+	cleanup, err := NewCleanup( xr )
+	if err != nil {
+		Out.Error( "Invalid cleanup rules: %v", err )
+		os.Exit(1)
+	}
 
-		var template Template
-		json.Unmarshal( []byte(so), &template )
+	parameterizer, err := NewParameterizer( xr )
+	if err != nil {
+		Out.Error( "Invalid parameters: %v", err )
+		os.Exit(1)
+	}
+
+	// Objects are written once every object has been selected so that owner
+	// references can be checked against the complete set.
+	type exportedObject struct {
+		fullName string
+		kind string
+		name string
+		obj map[string]interface{}
+		mappedImages map[string]string // container name => mapped image
+	}
+	var pending []exportedObject
 
-		for _, ao := range template.Objects {
-			obj := ao.(map[string]interface{})
-			kind := pluralizeKind( obj["kind"].(string) )
+	// Objects pulled in by includeDependencies, mapped to the reason they
+	// were added. They are appended to include as they are discovered.
+	dependencies := map[string]string{}
+	exported := map[string]struct{}{}
 
-			if kind == "" {
+	for n := 0; n < len( include ); n++ {
+		i := include[n]
+
+		objects, err := OC.Export( projectName, i )
+		if err != nil {
+			if reason, ok := dependencies[ i ]; ok {
+				Out.Warn( "Unable to export %v (referenced by %v): %v", i, reason, err )
+			} else {
+				Out.Warn( "Unable to export object definitions %v: %v", i, err )
+			}
+		}
+
+		for _, obj := range objects {
+			if k, _ := obj["kind"].(string); k == "" {
 				Out.Error( "Selected object does not specify kind: %v", obj )
 				os.Exit(1)
 			}
-
+			kind := ObjectKind( obj )
 
 			metadata := obj["metadata"].(map[string]interface{})
-			delete( metadata, "namespace" ) // secrets are presently exported "exact", so delete namespace
+			delete( metadata, "namespace" ) // objects are imported into the target namespace
 			name := metadata["name"].(string)
 
 			if name == "" {
@@ -179,9 +373,27 @@ func runExport(config *ExportConfig, cmd *cobra.Command, args []string) {
 				os.Exit(1)
 			}
 
-			fullName := NormalizeType( strings.Join( []string{ kind, name}, "/" ) )
+			fullName := strings.Join( []string{ kind, name}, "/" )
+
+			if _, ok := exported[ fullName ]; ok {
+				continue // Selected by more than one include entry
+			}
 
-			if selectedNames != nil {
+			_, isDependency := dependencies[ fullName ]
+
+			if patterns, ok := kindPatterns[ kind ]; ok && ! isDependency {
+				_, unfiltered := unfilteredKinds[ kind ]
+				_, literal := literalNames[ fullName ]
+				selected := unfiltered || literal
+				for _, pattern := range patterns {
+					selected = selected || isMatchedByKindNameEntry( fullName, pattern )
+				}
+				if ! selected {
+					continue
+				}
+			}
+
+			if selectedNames != nil && ! isDependency {
 				_, ok := selectedNames[ fullName ]
 				if !ok {
 					Out.Info( "Selectors matched item not in includes: %v", fullName )
@@ -194,6 +406,43 @@ func runExport(config *ExportConfig, cmd *cobra.Command, args []string) {
 				continue
 			}
 
+			if kind == KIND_SECRET && secretsMode == SECRETS_SKIP {
+				Out.Info( "Skipping secret (secrets mode %v): %v", secretsMode, fullName )
+				continue
+			}
+
+			_, isWildcard := wildcardKinds[ kind ]
+			if isWildcard && ignore.ignoresObject( kind, obj ) {
+				Out.Debug( "Ignoring controller owned object: %v", fullName )
+				continue
+			}
+
+			// Mutators which were not explicitly included are skipped rather than rejected
+			if ( isWildcard || isDependency ) && ( kind == KIND_IS || kind == KIND_BC ) && ! IsMatchedByKindNameList( fullName, xr.Spec.ExportRules.Transforms.PreserveMutators ) {
+				Out.Info( "Skipping mutator not specified in preserveMutators: %v", fullName )
+				continue
+			}
+
+			exported[ fullName ] = struct{}{}
+
+			if isDependency {
+				Out.Info( "Including %v (referenced by %v)", fullName, dependencies[ fullName ] )
+			}
+
+			if xr.Spec.ExportRules.IncludeDependencies {
+				namespace, _ := GetJSONPath( obj, "metadata", "namespace" ).(string)
+				for _, ref := range FindReferences( obj, namespace ) {
+					if _, ok := exported[ ref.FullName ]; ok {
+						continue
+					}
+					if _, ok := dependencies[ ref.FullName ]; ok {
+						continue
+					}
+					dependencies[ ref.FullName ] = fullName + " via " + ref.Via
+					include = append( include, ref.FullName )
+				}
+			}
+
 			if ! IsMatchedByKindNameList( fullName, xr.Spec.ExportRules.Transforms.PreserveMutators ) {
 
 				// Disallow build related artifacts from being exported
@@ -205,8 +454,8 @@ func runExport(config *ExportConfig, cmd *cobra.Command, args []string) {
 					os.Exit(1)
 				}
 
-				// Remove ImageChange triggers
-				if kind == KIND_DC {
+				// Remove ImageChange triggers unless they are rewritten below
+				if kind == KIND_DC && imageTriggers == IMAGE_TRIGGERS_STRIP {
 					triggers := GetJSONPath( obj, "spec", "triggers" )
 					if triggers != nil {
 						triggers = VisitJSONArrayElements( triggers, func( entry interface{} ) (interface{}) {
@@ -220,9 +469,16 @@ func runExport(config *ExportConfig, cmd *cobra.Command, args []string) {
 					}
 				}
 
+			} else if imageTriggers == IMAGE_TRIGGERS_REWRITE {
+				err := images.RewriteMutatorImageSources( obj, kind, fullName )
+				if err != nil {
+					Out.Error( "%v", err )
+					os.Exit(1)
+				}
 			}
 
 			// Rewrite image references
+			mappedImages := map[string]string{} // container name => mapped image
 			if kind == KIND_DC || kind == KIND_RC {
 				containers := GetJSONPath( obj, "spec", "template", "spec", "containers" )
 				if containers != nil {
@@ -230,61 +486,43 @@ func runExport(config *ExportConfig, cmd *cobra.Command, args []string) {
 						imageObj := GetJSONPath( entry, "image" )
 						if imageObj != nil {
 							image := imageObj.(string)
-							registryHost, namespace, repository, tag, err := ParseDockerImageRef( image )
-
+							newRef, mapping, err := images.MapImage( image )
 							if err != nil {
-								Out.Error( "Invalid docker image reference in %v: %v", fullName, image )
+								Out.Error( "Invalid docker image reference or mapping in %v: %v", fullName, err )
 								os.Exit(1)
 							}
 
-							for _,mapping := range xr.Spec.ExportRules.Transforms.ImageMappings {
-								ok, err := dockerPatternMatches( image, mapping.Pattern, "172.", projectName )
+							if mapping != nil {
+								Out.Info( "Mapping image reference in %v: %q -> %q", fullName, image, newRef )
+								SetJSONObj( entry, "image", newRef )
+								if name, ok := GetJSONPath( entry, "name" ).(string); ok {
+									mappedImages[ name ] = newRef
+								}
+
+								if config.dryRun {
+									Out.Info( "Dry run; not tagging or pushing docker image: %v", newRef )
+									return entry
+								}
+
+								_,se,err := Exec( "docker", "tag", image, newRef )
 								if err != nil {
-									Out.Error( "Invalid docker image mapping pattern: %v", mapping.Pattern )
+									Out.Error( "Error tagging docker image (%v) as (%v) [%v]: %v", image, newRef, err, se )
 									os.Exit(1)
 								}
 
-								if ok {
-									var newRef string
-									newRef += mapDockerComponentWithSuffix(registryHost, mapping.SetRegistryHost, "/" )
-									newRef += mapDockerComponentWithSuffix(namespace, mapping.SetNamespace, "/" )
-									newRef += mapDockerComponent(repository, mapping.SetRepository )
-									switch mapping.TagType {
-									case "user":
-										newRef += mapDockerTagComponentWithPrefix(tag, mapping.SetTag )
-									case "generated":
-										// Formulate a highly unique tag
-										newRef += generatedTag
-									default:
-										Out.Error( "ImageMapping tagType not presently supported: %v", mapping.TagType )
-										os.Exit(1)
-									}
-
-									Out.Info( "Mapping image reference in %v: %q -> %q", fullName, image, newRef )
-									SetJSONObj( entry, "image", newRef )
+								if mapping.Secret != "" {
+									Out.Error( "Docker secrets are not presently supported; log into the necessary docker registries from the command line for push operations" )
+									os.Exit(1)
+								}
 
-									_,se,err = Exec( "docker", "tag", image, newRef )
+								if mapping.Push == nil || *mapping.Push {
+									Out.Info( "Pushing docker image: %v", newRef )
+									_,se,err = Exec( "docker", "push", newRef )
 									if err != nil {
-										Out.Error( "Error tagging docker image (%v) as (%v) [%v]: %v", image, newRef, err, se )
+										Out.Error( "Error pushing docker image (%v) as newly tagged (%v) [%v]: %v", image, newRef, err, se )
+										Out.Error( "Make sure you are logged into the destination registry")
 										os.Exit(1)
 									}
-
-									if mapping.Secret != "" {
-										Out.Error( "Docker secrets are not presently supported; log into the necessary docker registries from the command line for push operations" )
-										os.Exit(1)
-									}
-
-									if mapping.Push == nil || *mapping.Push {
-										Out.Info( "Pushing docker image: %v", newRef )
-										_,se,err = Exec( "docker", "push", newRef )
-										if err != nil {
-											Out.Error( "Error pushing docker image (%v) as newly tagged (%v) [%v]: %v", image, newRef, err, se )
-											Out.Error( "Make sure you are logged into the destination registry")
-											os.Exit(1)
-										}
-									}
-
-									break // Only perform one mapping. The first one that matches.
 								}
 							}
 						}
@@ -293,63 +531,145 @@ func runExport(config *ExportConfig, cmd *cobra.Command, args []string) {
 				}
 			}
 
+			cleanup.Apply( fullName, obj )
+			parameterizer.Apply( fullName, obj )
+
+			if kind == KIND_SECRET && secretsMode == SECRETS_REDACT {
+				Out.Info( "Redacting secret values: %v", fullName )
+				RedactSecret( obj )
+			} else if kind == KIND_SECRET && encryptor != nil {
+				err = encryptor.EncryptObject( obj )
+				if err != nil {
+					Out.Error( "Unable to encrypt %v: %v", fullName, err )
+					os.Exit(1)
+				}
+			}
+
 			Out.Info( "Exporting: %v", fullName )
+			pending = append( pending, exportedObject{ fullName, kind, name, obj, mappedImages } )
+		}
+	}
+
+	parameterizer.ReportUnused()
 
+	for _, p := range pending {
+		obj := p.obj
+		cleanup.ApplyOwnerReferences( p.fullName, obj, exported )
 
-			kindDir := filepath.Join( git.objectDir, kind )
-			err = os.MkdirAll( kindDir, 0700 )
+		// Triggers are rewritten once it is known which imagestreams are exported
+		if p.kind == KIND_DC && imageTriggers == IMAGE_TRIGGERS_REWRITE {
+			err := images.RewriteImageTriggers( obj, p.fullName, p.mappedImages, exported )
 			if err != nil {
-				Out.Error( "Error creating object directory (%v): %v", kindDir, err )
+				Out.Error( "%v", err )
 				os.Exit(1)
 			}
+		}
 
-			SetLabel( obj, LABEL_REPOSITORY, xr.Metadata.Name )
-			SetLabel( obj, LABEL_REPOSITORY_VERSION, config.version )
+		kindDir := filepath.Join( store.ObjectDir(), p.kind )
+		err = os.MkdirAll( kindDir, 0700 )
+		if err != nil {
+			Out.Error( "Error creating object directory (%v): %v", kindDir, err )
+			os.Exit(1)
+		}
 
-			objectFilePath := filepath.Join( kindDir, name + ".json" )
-			objData, err := json.MarshalIndent( obj, "", "\t" )
+		SetLabel( obj, LABEL_REPOSITORY, xr.Metadata.Name )
+		SetLabel( obj, LABEL_REPOSITORY_VERSION, config.version )
 
-			if err != nil {
-				Out.Error( "Error marshalling object data (%v): %v", err, obj )
-				os.Exit(1)
-			}
+		objectFilePath := filepath.Join( kindDir, p.name + ".json" )
+		objData, err := json.MarshalIndent( obj, "", "\t" )
 
-			err = ioutil.WriteFile( objectFilePath, objData, 0600 )
-			if err != nil {
-				Out.Error( "Error writing object data to file (%v) [%v]", objectFilePath, err )
-				os.Exit(1)
-			}
+		if err != nil {
+			Out.Error( "Error marshalling object data (%v): %v", err, obj )
+			os.Exit(1)
+		}
+
+		err = ioutil.WriteFile( objectFilePath, objData, 0600 )
+		if err != nil {
+			Out.Error( "Error writing object data to file (%v) [%v]", objectFilePath, err )
+			os.Exit(1)
 		}
 	}
 
-	err = RunPatches( xr, git.objectDir )
+	err = RunPatches( xr, xr.Spec.ExportRules.Transforms.Patches, store.ObjectDir(), PatchContext{ Phase: "export", Version: config.version, Namespace: projectName } )
 	if err != nil {
 		Out.Error( "Error executing export patches: %v", err )
 		os.Exit(1)
 	}
 
-	_,se,err = git.Exec( "add", "." )
-
+	changes, err := store.Changes()
 	if err != nil {
-		Out.Error( "Error adding tracked files to git branch (%v) [%v]: %v", branchName, err, se )
+		Out.Error( "Error determining object changes: %v", err )
 		os.Exit(1)
 	}
 
-	if config.message == "" {
-		config.message = fmt.Sprintf( "Version: %v (tag=%v) (date=%v)", config.version, generatedTag, time.Now().Format(time.UnixDate) )
-	}
+	// Each export generates a new image tag. Objects which differ from the
+	// prior version only by that tag are not considered changed.
+	generatedTagPattern := regexp.MustCompile( regexp.QuoteMeta( ":" + config.version + "_" ) + "[0-9]+" )
 
-	_,se,err = git.Exec( "commit", "-m", config.message )
+	// Encryption produces new ciphertext on every export. With a decryption
+	// key, secrets whose plaintext is unchanged are not considered changed.
+	decryptor, err := NewSecretDecryptor( config.decryptionKey )
+	if err != nil {
+		Out.Error( "%v", err )
+		os.Exit(1)
+	}
+	if decryptor != nil {
+		defer decryptor.Close()
+	} else if encryptor != nil {
+		Out.Info( "No decryption key supplied; every encrypted secret will be reported as modified" )
+	}
 
+	err = store.RevertEquivalent( changes, func( old, new string ) bool {
+		old = generatedTagPattern.ReplaceAllString( old, "" )
+		new = generatedTagPattern.ReplaceAllString( new, "" )
+		if old == new {
+			return true
+		}
+		if decryptor == nil || ! strings.Contains( new, "ENC[" ) {
+			return false
+		}
+		oldPlain, err := decryptor.DecryptText( old )
+		if err != nil {
+			Out.Warn( "Unable to decrypt prior version for comparison: %v", err )
+			return false
+		}
+		newPlain, err := decryptor.DecryptText( new )
+		if err != nil {
+			Out.Warn( "Unable to decrypt exported object for comparison: %v", err )
+			return false
+		}
+		return oldPlain == newPlain
+	})
 	if err != nil {
-		Out.Error( "Error committing files to git branch (%v) [%v]: %v", branchName, err, se )
+		Out.Error( "Error comparing objects with version (%v): %v", config.version, err )
 		os.Exit(1)
 	}
 
-	_,se,err = git.Exec( "push", "--set-upstream", "origin", branchName )
+	changes.Report( "version " + config.version )
+
+	if changes.Empty() {
+		// The prior version's objects are kept, and they name the images
+		// tagged by the export which published them.
+		if tag := findGeneratedTag( store.ObjectDir(), generatedTagPattern ); tag != "" {
+			config.generatedTag = tag
+		}
+		Out.Info( "No changes to export; version %v is up to date.", config.version )
+		return
+	}
+
+	if config.message == "" {
+		config.message = fmt.Sprintf( "Version: %v (tag=%v) (date=%v)", config.version, generatedTag, time.Now().Format(time.UnixDate) )
+	}
+	config.message += "\n\n" + changes.Summary()
+
+	if config.dryRun {
+		Out.Info( "Dry run; version %v was not published.", config.version )
+		return
+	}
 
+	err = store.Publish( config.message )
 	if err != nil {
-		Out.Error( "Error pushing git branch (%v) [%v]: %v", branchName, err, se )
+		Out.Error( "Error publishing version %v: %v", config.version, err )
 		os.Exit(1)
 	}
 
@@ -362,4 +682,9 @@ func init() {
 	exportCmd.Flags().StringVar(&_exportConfig.version, "to", "", "Version to export")
 	exportCmd.Flags().StringVar(&_exportConfig.message, "message", "", "Message for commits")
 	exportCmd.Flags().BoolVar(&_exportConfig.overwrite, "overwrite", false, "Specify to permit branch overwrites")
+	exportCmd.Flags().BoolVar(&_exportConfig.dryRun, "dry-run", false, "Report the changes an export would make without pushing images or publishing the version")
+	exportCmd.Flags().StringVar(&_exportConfig.reviewBranch, "review-branch", "", "Commit the export to this branch, based on the version branch, instead of updating the version branch; an existing review branch is continued")
+	exportCmd.Flags().StringVar(&_exportConfig.signingKey, "signing-key", "", "Key used to sign the export commit (overrides git.signing.key)")
+	exportCmd.Flags().StringVar(&_exportConfig.decryptionKey, "decryption-key", "", "Private key file used to compare encrypted secrets with the prior version (default $" + ENV_DECRYPTION_KEY + ")")
+	exportCmd.Flags().StringVar(&_exportConfig.signingFormat, "signing-format", "", "Format of the signing key: ssh or openpgp (overrides git.signing.format)")
 }
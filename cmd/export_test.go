@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"sort"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseExportIgnoreList( t *testing.T ) {
+	useBuiltinKinds( t )
+	il := parseExportIgnoreList( "events, dc:owned, ,imagestreamtags.image.openshift.io" )
+
+	cases := []struct {
+		kind string
+		expected bool
+	}{
+		{ "events", true },
+		{ "imagestreamtags.image.openshift.io", true },
+		{ KIND_DC, false }, // only owned objects are ignored
+		{ KIND_CONFIGMAP, false },
+	}
+	for _, tc := range cases {
+		if il.ignoresKind( tc.kind ) != tc.expected {
+			t.Errorf( "ignoresKind(%v) = %v, expected %v", tc.kind, !tc.expected, tc.expected )
+		}
+	}
+
+	owned := parseTestObject( t, `{ "metadata": { "ownerReferences": [ { "kind": "X", "name": "x", "controller": true } ] } }` )
+	referenced := parseTestObject( t, `{ "metadata": { "ownerReferences": [ { "kind": "X", "name": "x" } ] } }` )
+	unowned := parseTestObject( t, `{ "metadata": {} }` )
+
+	objectCases := []struct {
+		kind string
+		obj map[string]interface{}
+		expected bool
+	}{
+		{ KIND_DC, owned, true },
+		{ KIND_DC, referenced, false }, // not a controller
+		{ KIND_DC, unowned, false },
+		{ KIND_CONFIGMAP, owned, false },
+	}
+	for i, tc := range objectCases {
+		if il.ignoresObject( tc.kind, tc.obj ) != tc.expected {
+			t.Errorf( "case %v: ignoresObject(%v) = %v, expected %v", i, tc.kind, !tc.expected, tc.expected )
+		}
+	}
+}
+
+func TestExportableKinds( t *testing.T ) {
+	verbs := []string{ "list", "get", "create", "delete" }
+	newTestClusterWithResources( t, []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{ Name: "pods", Kind: "Pod", Namespaced: true, Verbs: verbs },
+				{ Name: "pods/log", Kind: "Pod", Namespaced: true, Verbs: []string{ "get" } },
+				{ Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: verbs },
+				{ Name: "events", Kind: "Event", Namespaced: true, Verbs: verbs },
+				{ Name: "endpoints", Kind: "Endpoints", Namespaced: true, Verbs: verbs },
+				{ Name: "namespaces", Kind: "Namespace", Namespaced: false, Verbs: verbs },
+				{ Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: []string{ "create" } },
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{ Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: verbs },
+				{ Name: "controllerrevisions", Kind: "ControllerRevision", Namespaced: true, Verbs: verbs },
+			},
+		},
+		{
+			GroupVersion: "image.openshift.io/v1",
+			APIResources: []metav1.APIResource{
+				{ Name: "imagestreams", Kind: "ImageStream", Namespaced: true, Verbs: verbs },
+				{ Name: "imagestreamtags", Kind: "ImageStreamTag", Namespaced: true, Verbs: verbs },
+			},
+		},
+	})
+
+	ignore := parseExportIgnoreList( DEFAULT_EXPORT_IGNORE )
+	cases := []struct {
+		entry string
+		expected []string
+	}{
+		// Owned-only entries are still enumerated; their objects are filtered on export
+		{ "*", []string{ "pods", "configmaps", "deployments.apps", "controllerrevisions.apps", "imagestreams.image.openshift.io" } },
+		{ "*.apps", []string{ "deployments.apps", "controllerrevisions.apps" } },
+		{ "imagestream*/web", []string{ "imagestreams.image.openshift.io" } },
+		{ "re:^configmaps/", []string{ "pods", "configmaps", "deployments.apps", "controllerrevisions.apps", "imagestreams.image.openshift.io" } },
+	}
+	for _, tc := range cases {
+		kinds, err := exportableKinds( tc.entry, ignore )
+		if err != nil {
+			t.Fatalf( "exportableKinds(%v): %v", tc.entry, err )
+		}
+		sort.Strings( kinds )
+		sort.Strings( tc.expected )
+		if !reflect.DeepEqual( kinds, tc.expected ) {
+			t.Errorf( "exportableKinds(%v) = %v, expected %v", tc.entry, kinds, tc.expected )
+		}
+	}
+}
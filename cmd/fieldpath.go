@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type pathSegment struct {
+	key string
+	index int // -1 unless the segment is an array index
+	each bool // [*]
+}
+
+// A location within an object definition such as "spec.ports[*].nodePort"
+// or `metadata.annotations["openshift.io/host.generated"]`. Keys containing
+// dots must be quoted within brackets.
+type FieldPath struct {
+	path string
+	segments []pathSegment
+}
+
+func ParseFieldPath( path string ) (*FieldPath, error) {
+	fp := &FieldPath{ path: path }
+	invalid := func( reason string ) (*FieldPath, error) {
+		return nil, fmt.Errorf( "Invalid field path %q: %v", path, reason )
+	}
+
+	key := ""
+	keyPending := false
+	flushKey := func() {
+		if keyPending {
+			fp.segments = append( fp.segments, pathSegment{ key: key, index: -1 } )
+		}
+		key = ""
+		keyPending = false
+	}
+
+	for i := 0; i < len( path ); i++ {
+		c := path[i]
+		switch c {
+		case '.':
+			if ! keyPending && ( i == 0 || path[i-1] == '.' ) {
+				return invalid( "empty key" )
+			}
+			flushKey()
+		case '[':
+			flushKey()
+			end := strings.IndexByte( path[i:], ']' )
+			if end < 0 {
+				return invalid( "unterminated [" )
+			}
+			inner := path[i+1 : i+end]
+			if inner != "" && ( inner[0] == '"' || inner[0] == '\'' ) {
+				// A quoted key may contain ']'
+				closing := strings.IndexByte( path[i+2:], inner[0] )
+				if closing < 0 || i+2+closing+1 >= len( path ) || path[i+2+closing+1] != ']' {
+					return invalid( "unterminated quoted key" )
+				}
+				fp.segments = append( fp.segments, pathSegment{ key: path[i+2 : i+2+closing], index: -1 } )
+				i = i + 2 + closing + 1
+				continue
+			}
+			if inner == "*" {
+				fp.segments = append( fp.segments, pathSegment{ index: -1, each: true } )
+			} else {
+				n, err := strconv.Atoi( inner )
+				if err != nil || n < 0 {
+					return invalid( "expected [*], [<index>] or [\"<key>\"]" )
+				}
+				fp.segments = append( fp.segments, pathSegment{ index: n } )
+			}
+			i += end
+		default:
+			key += string( c )
+			keyPending = true
+		}
+	}
+	flushKey()
+
+	if len( fp.segments ) == 0 {
+		return invalid( "empty path" )
+	}
+	return fp, nil
+}
+
+func (fp *FieldPath) String() string {
+	return fp.path
+}
+
+// Returns every value at the path. [*] segments may produce several values.
+func (fp *FieldPath) Values( obj interface{} ) []interface{} {
+	var values []interface{}
+	fp.visit( obj, fp.segments, func( v interface{} ) {
+		values = append( values, v )
+	})
+	return values
+}
+
+func (fp *FieldPath) visit( at interface{}, segments []pathSegment, fn func( v interface{} ) ) {
+	if len( segments ) == 0 {
+		fn( at )
+		return
+	}
+	seg := segments[0]
+	switch {
+	case seg.each:
+		arr, _ := at.([]interface{})
+		for _, v := range arr {
+			fp.visit( v, segments[1:], fn )
+		}
+	case seg.index >= 0:
+		arr, _ := at.([]interface{})
+		if seg.index < len( arr ) {
+			fp.visit( arr[ seg.index ], segments[1:], fn )
+		}
+	default:
+		m, _ := at.(map[string]interface{})
+		if v, ok := m[ seg.key ]; ok {
+			fp.visit( v, segments[1:], fn )
+		}
+	}
+}
+
+// Sets the value at the path, creating intermediate maps for keys which
+// are not present. Returns the number of locations set.
+func (fp *FieldPath) Set( obj interface{}, value interface{} ) int {
+	count := 0
+	fp.update( obj, fp.segments, func( old interface{}, present bool ) (interface{}, bool) {
+		count++
+		return value, true
+	}, true )
+	return count
+}
+
+// Removes the values at the path for which keep returns false. keep may be
+// nil to remove every value. Removed array elements are deleted from the
+// array. Returns the number of values removed.
+func (fp *FieldPath) Remove( obj interface{}, keep func( v interface{} ) bool ) int {
+	count := 0
+	fp.update( obj, fp.segments, func( old interface{}, present bool ) (interface{}, bool) {
+		if ! present || ( keep != nil && keep( old ) ) {
+			return old, present
+		}
+		count++
+		return nil, false
+	}, false )
+	return count
+}
+
+// Walks to each location at the path and replaces its value with the
+// result of fn. fn returns false to delete the location. Returns the
+// possibly reallocated container.
+func (fp *FieldPath) update( at interface{}, segments []pathSegment, fn func( old interface{}, present bool ) (interface{}, bool), create bool ) interface{} {
+	seg := segments[0]
+	last := len( segments ) == 1
+
+	if seg.each || seg.index >= 0 {
+		arr, ok := at.([]interface{})
+		if ! ok {
+			return at
+		}
+		var result []interface{}
+		for i, v := range arr {
+			if seg.each || i == seg.index {
+				if last {
+					nv, keep := fn( v, true )
+					if ! keep {
+						continue
+					}
+					v = nv
+				} else {
+					v = fp.update( v, segments[1:], fn, create )
+				}
+			}
+			result = append( result, v )
+		}
+		if result == nil {
+			result = []interface{}{}
+		}
+		return result
+	}
+
+	m, ok := at.(map[string]interface{})
+	if ! ok {
+		return at
+	}
+	v, present := m[ seg.key ]
+	if last {
+		nv, keep := fn( v, present )
+		if keep {
+			m[ seg.key ] = nv
+		} else {
+			delete( m, seg.key )
+		}
+		return m
+	}
+	if ! present {
+		if ! create || segments[1].each || segments[1].index >= 0 {
+			return m
+		}
+		v = map[string]interface{}{}
+	}
+	m[ seg.key ] = fp.update( v, segments[1:], fn, create )
+	return m
+}
+
+// Replaces each value present at the path with the result of fn. Returns
+// the number of values replaced.
+func (fp *FieldPath) Replace( obj interface{}, fn func( v interface{} ) interface{} ) int {
+	count := 0
+	fp.update( obj, fp.segments, func( old interface{}, present bool ) (interface{}, bool) {
+		if ! present {
+			return old, false
+		}
+		count++
+		return fn( old ), true
+	}, false )
+	return count
+}
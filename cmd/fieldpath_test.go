@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testFieldPathObject = `{
+	"metadata": { "name": "web", "annotations": { "openshift.io/host.generated": "true", "a]b": "x" } },
+	"spec": { "ports": [ { "port": 80, "nodePort": 30080 }, { "port": 443, "nodePort": 30443 } ] }
+}`
+
+func TestParseFieldPath( t *testing.T ) {
+	cases := []struct {
+		path string
+		expected []pathSegment // nil for an error
+	}{
+		{ "status", []pathSegment{ { key: "status", index: -1 } } },
+		{ "spec.ports[*].nodePort", []pathSegment{ { key: "spec", index: -1 }, { key: "ports", index: -1 }, { index: -1, each: true }, { key: "nodePort", index: -1 } } },
+		{ "spec.ports[1]", []pathSegment{ { key: "spec", index: -1 }, { key: "ports", index: -1 }, { index: 1 } } },
+		{ `metadata.annotations["openshift.io/host.generated"]`, []pathSegment{ { key: "metadata", index: -1 }, { key: "annotations", index: -1 }, { key: "openshift.io/host.generated", index: -1 } } },
+		{ `metadata.annotations['a]b']`, []pathSegment{ { key: "metadata", index: -1 }, { key: "annotations", index: -1 }, { key: "a]b", index: -1 } } },
+		{ "", nil },
+		{ ".spec", nil },
+		{ "spec..ports", nil },
+		{ "spec.ports[", nil },
+		{ "spec.ports[-1]", nil },
+		{ "spec.ports[x]", nil },
+		{ `metadata.annotations["a`, nil },
+	}
+	for _, tc := range cases {
+		fp, err := ParseFieldPath( tc.path )
+		if tc.expected == nil {
+			if err == nil {
+				t.Errorf( "ParseFieldPath(%q): expected an error", tc.path )
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf( "ParseFieldPath(%q): %v", tc.path, err )
+			continue
+		}
+		if !reflect.DeepEqual( fp.segments, tc.expected ) {
+			t.Errorf( "ParseFieldPath(%q) = %+v, expected %+v", tc.path, fp.segments, tc.expected )
+		}
+	}
+}
+
+func TestFieldPathValues( t *testing.T ) {
+	cases := []struct {
+		path string
+		expected []interface{}
+	}{
+		{ "metadata.name", []interface{}{ "web" } },
+		{ "spec.ports[*].nodePort", []interface{}{ 30080.0, 30443.0 } },
+		{ "spec.ports[1].port", []interface{}{ 443.0 } },
+		{ "spec.ports[2].port", nil },
+		{ `metadata.annotations["openshift.io/host.generated"]`, []interface{}{ "true" } },
+		{ "metadata.name.missing", nil },
+	}
+	for _, tc := range cases {
+		fp, err := ParseFieldPath( tc.path )
+		if err != nil {
+			t.Fatal( err )
+		}
+		values := fp.Values( parseTestObject( t, testFieldPathObject ) )
+		if !reflect.DeepEqual( values, tc.expected ) {
+			t.Errorf( "Values(%q) = %v, expected %v", tc.path, values, tc.expected )
+		}
+	}
+}
+
+func TestFieldPathUpdates( t *testing.T ) {
+	cases := []struct {
+		op string
+		path string
+		count int
+		expected string
+	}{
+		{ "set", "spec.ports[*].nodePort", 2,
+			`{ "metadata": { "name": "web", "annotations": { "openshift.io/host.generated": "true", "a]b": "x" } }, "spec": { "ports": [ { "port": 80, "nodePort": 1 }, { "port": 443, "nodePort": 1 } ] } }` },
+		// Intermediate maps are created, but not arrays
+		{ "set", "spec.template.replicas", 1,
+			`{ "metadata": { "name": "web", "annotations": { "openshift.io/host.generated": "true", "a]b": "x" } }, "spec": { "template": { "replicas": 1 }, "ports": [ { "port": 80, "nodePort": 30080 }, { "port": 443, "nodePort": 30443 } ] } }` },
+		{ "set", "spec.containers[0].image", 0,
+			testFieldPathObject },
+		{ "remove", "spec.ports[*].nodePort", 2,
+			`{ "metadata": { "name": "web", "annotations": { "openshift.io/host.generated": "true", "a]b": "x" } }, "spec": { "ports": [ { "port": 80 }, { "port": 443 } ] } }` },
+		{ "remove", "spec.ports[0]", 1,
+			`{ "metadata": { "name": "web", "annotations": { "openshift.io/host.generated": "true", "a]b": "x" } }, "spec": { "ports": [ { "port": 443, "nodePort": 30443 } ] } }` },
+		{ "remove", `metadata.annotations["openshift.io/host.generated"]`, 1,
+			`{ "metadata": { "name": "web", "annotations": { "a]b": "x" } }, "spec": { "ports": [ { "port": 80, "nodePort": 30080 }, { "port": 443, "nodePort": 30443 } ] } }` },
+		{ "remove", "status", 0,
+			testFieldPathObject },
+		{ "replace", "spec.ports[*].port", 2,
+			`{ "metadata": { "name": "web", "annotations": { "openshift.io/host.generated": "true", "a]b": "x" } }, "spec": { "ports": [ { "port": 1, "nodePort": 30080 }, { "port": 1, "nodePort": 30443 } ] } }` },
+		// Missing values are not created
+		{ "replace", "spec.replicas", 0,
+			testFieldPathObject },
+	}
+	for _, tc := range cases {
+		fp, err := ParseFieldPath( tc.path )
+		if err != nil {
+			t.Fatal( err )
+		}
+		obj := parseTestObject( t, testFieldPathObject )
+		var count int
+		switch tc.op {
+		case "set":
+			count = fp.Set( obj, 1.0 )
+		case "remove":
+			count = fp.Remove( obj, nil )
+		case "replace":
+			count = fp.Replace( obj, func( v interface{} ) interface{} { return 1.0 } )
+		}
+		if count != tc.count {
+			t.Errorf( "%v %q: count %v, expected %v", tc.op, tc.path, count, tc.count )
+		}
+		if expected := parseTestObject( t, tc.expected ); !reflect.DeepEqual( obj, expected ) {
+			t.Errorf( "%v %q:\n%v\nexpected\n%v", tc.op, tc.path, obj, expected )
+		}
+	}
+}
+
+func TestFieldPathRemoveKeep( t *testing.T ) {
+	fp, err := ParseFieldPath( "spec.ports[*]" )
+	if err != nil {
+		t.Fatal( err )
+	}
+	obj := parseTestObject( t, testFieldPathObject )
+	count := fp.Remove( obj, func( v interface{} ) bool {
+		return GetJSONPath( v, "port" ) == 443.0
+	})
+	if count != 1 {
+		t.Errorf( "removed %v ports, expected 1", count )
+	}
+	if ports := GetJSONPath( obj, "spec", "ports" ).([]interface{}); len( ports ) != 1 || GetJSONPath( ports[0], "port" ) != 443.0 {
+		t.Errorf( "ports = %v", ports )
+	}
+}
@@ -0,0 +1,359 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	IMAGE_TRIGGERS_STRIP = "strip"
+	IMAGE_TRIGGERS_REWRITE = "rewrite"
+)
+
+// Hosts of the integrated registry in OpenShift 4 and 3 clusters. Images
+// pushed there are served by imagestreams of the same namespace and name.
+var defaultIntegratedRegistries = []string{
+	"image-registry.openshift-image-registry.svc:5000",
+	"docker-registry.default.svc:5000",
+}
+
+type ExportImageMapping struct {
+	Pattern string `json:"pattern"`
+	SetRegistryHost *string `json:"setRegistryHost"`
+	SetNamespace *string `json:"setNamespace"`
+	SetRepository *string `json:"setRepository"`
+	SetTag *string `json:"setTag"`
+	Push *bool `json:"push"`
+	TagType string `json:"tagType"`
+	Secret string `json:"secret"`
+}
+
+// Applies the first export image mapping matching an image reference.
+// Registries starting with internalRegistry match the "~/" pattern
+// registry. Returns the mapping applied, or nil if none matches.
+func mapExportImageRef( mappings []ExportImageMapping, image string, internalRegistry string, projectName string, generatedTag string ) (string, *ExportImageMapping, error) {
+	registryHost, namespace, repository, tag, err := ParseDockerImageRef( image )
+	if err != nil {
+		return "", nil, err
+	}
+
+	for i, mapping := range mappings {
+		ok, err := dockerPatternMatches( image, mapping.Pattern, internalRegistry, projectName )
+		if err != nil {
+			return "", nil, fmt.Errorf( "Invalid docker image mapping: %v", err )
+		}
+		if !ok {
+			continue
+		}
+
+		var newRef string
+		newRef += mapDockerComponentWithSuffix(registryHost, mapping.SetRegistryHost, "/" )
+		newRef += mapDockerComponentWithSuffix(namespace, mapping.SetNamespace, "/" )
+		newRef += mapDockerComponent(repository, mapping.SetRepository )
+		switch mapping.TagType {
+		case "user":
+			newRef += mapDockerTagComponentWithPrefix(tag, mapping.SetTag )
+		case "generated":
+			// Formulate a highly unique tag
+			newRef += generatedTag
+		default:
+			return "", nil, fmt.Errorf( "ImageMapping tagType not presently supported: %v", mapping.TagType )
+		}
+		return newRef, &mappings[i], nil // Only perform one mapping. The first one that matches.
+	}
+	return image, nil, nil
+}
+
+// The state needed to rewrite image references consistently with the
+// export image mappings.
+type ImageRewriter struct {
+	mappings []ExportImageMapping
+	integratedRegistries []string
+	projectName string
+	generatedTag string
+}
+
+// The XR's integratedRegistry names the host of the target cluster's
+// integrated registry; the well known service hosts are used otherwise.
+func NewImageRewriter( xr *XR, projectName string, generatedTag string ) *ImageRewriter {
+	transforms := xr.Spec.ExportRules.Transforms
+	registries := defaultIntegratedRegistries
+	if transforms.IntegratedRegistry != "" {
+		registries = []string{ transforms.IntegratedRegistry }
+	}
+	return &ImageRewriter{
+		mappings: transforms.ImageMappings,
+		integratedRegistries: registries,
+		projectName: projectName,
+		generatedTag: generatedTag,
+	}
+}
+
+// Returns true if images in the registry are served by imagestreams.
+// Addresses starting with 172. are the OpenShift 3 registry service IP,
+// as in image mapping patterns.
+func (ir *ImageRewriter) isIntegratedRegistry( registry string ) bool {
+	registry = strings.TrimSuffix( registry, "/" )
+	if strings.HasPrefix( registry, "172." ) {
+		return true
+	}
+	for _, r := range ir.integratedRegistries {
+		if registry == r {
+			return true
+		}
+	}
+	return false
+}
+
+// Maps a container image. Returns the mapping applied, or nil.
+func (ir *ImageRewriter) MapImage( image string ) (string, *ExportImageMapping, error) {
+	return mapExportImageRef( ir.mappings, image, "172.", ir.projectName, ir.generatedTag )
+}
+
+// Maps the image an ImageStreamTag or ImageStreamImage refers to, as pulled
+// from the integrated registry. Returns the mapping applied, or nil.
+func (ir *ImageRewriter) mapImageStreamRef( kind string, namespace string, name string ) (string, *ExportImageMapping, error) {
+	if namespace == "" {
+		namespace = ir.projectName
+	}
+	registry := ir.integratedRegistries[0]
+	if kind == "ImageStreamTag" && ! strings.Contains( name, ":" ) {
+		name += ":latest"
+	}
+	return mapExportImageRef( ir.mappings, registry + "/" + namespace + "/" + name, registry, ir.projectName, ir.generatedTag )
+}
+
+// Converts a mapped image reference into an imagestream reference if the
+// image is served by an imagestream in the target: it is pushed to the
+// integrated registry, or exported names an imagestream of the repository.
+// Returns false if the image is not served by an imagestream.
+func (ir *ImageRewriter) imageStreamSource( ref string, exported map[string]struct{} ) (map[string]interface{}, bool, error) {
+	registry, namespace, repository, tag, err := ParseDockerImageRef( ref )
+	if err != nil {
+		return nil, false, err
+	}
+	namespace = strings.TrimSuffix( namespace, "/" )
+
+	source := map[string]interface{}{}
+	switch {
+	case ir.isIntegratedRegistry( registry ):
+		if namespace != "" && namespace != ir.projectName {
+			source[ "namespace" ] = namespace
+		}
+	case exported != nil:
+		if _, ok := exported[ KIND_IS + "/" + repository ]; !ok {
+			return nil, false, nil
+		}
+	default:
+		return nil, false, nil
+	}
+
+	switch {
+	case strings.HasPrefix( tag, "@" ):
+		source[ "kind" ] = "ImageStreamImage"
+	case tag == "":
+		source[ "kind" ] = "ImageStreamTag"
+		tag = ":latest"
+	default:
+		source[ "kind" ] = "ImageStreamTag"
+	}
+	source[ "name" ] = repository + tag
+	return source, true, nil
+}
+
+func replaceMap( m map[string]interface{}, with map[string]interface{} ) {
+	for key := range m {
+		delete( m, key )
+	}
+	for key, value := range with {
+		m[ key ] = value
+	}
+}
+
+// Rewrites an image source reference ({kind, name, namespace}) so that it
+// follows the image mappings and resolves in the import namespace.
+// Imagestream references are mapped as images in the integrated registry;
+// if the mapped image is elsewhere, the source becomes a DockerImage unless
+// dockerAllowed is false, in which case false is returned.
+func (ir *ImageRewriter) rewriteImageSource( from map[string]interface{}, fullName string, dockerAllowed bool ) (bool, error) {
+	if from == nil {
+		return true, nil
+	}
+	kind, _ := from[ "kind" ].(string)
+	name, _ := from[ "name" ].(string)
+	namespace, _ := from[ "namespace" ].(string)
+
+	switch kind {
+	case "ImageStreamTag", "ImageStreamImage":
+		newRef, mapping, err := ir.mapImageStreamRef( kind, namespace, name )
+		if err != nil {
+			return false, fmt.Errorf( "Unable to map %v %v in %v: %v", kind, name, fullName, err )
+		}
+		if mapping == nil {
+			// References to other namespaces (e.g. openshift) are kept
+			if namespace == ir.projectName {
+				delete( from, "namespace" )
+			}
+			return true, nil
+		}
+		source, ok, err := ir.imageStreamSource( newRef, nil )
+		if err != nil {
+			return false, fmt.Errorf( "Invalid mapped image reference in %v: %v", fullName, err )
+		}
+		if !ok {
+			if ! dockerAllowed {
+				return false, nil
+			}
+			source = map[string]interface{}{ "kind": "DockerImage", "name": newRef }
+		}
+		Out.Info( "Mapping %v %v in %v to %v %v", kind, name, fullName, source[ "kind" ], source[ "name" ] )
+		replaceMap( from, source )
+	case "DockerImage":
+		newRef, mapping, err := ir.MapImage( name )
+		if err != nil {
+			return false, fmt.Errorf( "Unable to map image reference in %v: %v", fullName, err )
+		}
+		if mapping != nil {
+			Out.Info( "Mapping image reference in %v: %q -> %q", fullName, name, newRef )
+			from[ "name" ] = newRef
+		}
+	}
+	return true, nil
+}
+
+// Rewrites the image sources of a preserved buildconfig or imagestream.
+// Build ImageChange triggers whose image is no longer served by an
+// imagestream are removed.
+func (ir *ImageRewriter) RewriteMutatorImageSources( obj map[string]interface{}, kind string, fullName string ) error {
+	var sources []map[string]interface{}
+
+	switch kind {
+	case KIND_BC:
+		for _, strategy := range []string{ "sourceStrategy", "dockerStrategy", "customStrategy" } {
+			sources = append( sources, metadataMap( obj, false, "spec", "strategy", strategy, "from" ) )
+		}
+		sources = append( sources, metadataMap( obj, false, "spec", "output", "to" ) )
+		images, _ := GetJSONPath( obj, "spec", "source", "images" ).([]interface{})
+		for _, image := range images {
+			sources = append( sources, metadataMap( image, false, "from" ) )
+		}
+
+		triggers, _ := GetJSONPath( obj, "spec", "triggers" ).([]interface{})
+		var result []interface{}
+		for _, trigger := range triggers {
+			imageChange := metadataMap( trigger, false, "imageChange" )
+			delete( imageChange, "lastTriggeredImageID" )
+			ok, err := ir.rewriteImageSource( metadataMap( imageChange, false, "from" ), fullName, false )
+			if err != nil {
+				return err
+			}
+			if !ok {
+				Out.Warn( "Removing ImageChange trigger of %v; its mapped image is not served by an imagestream", fullName )
+				continue
+			}
+			result = append( result, trigger )
+		}
+		if triggers != nil {
+			if result == nil {
+				result = []interface{}{}
+			}
+			metadataMap( obj, false, "spec" )[ "triggers" ] = result
+		}
+	case KIND_IS:
+		tags, _ := GetJSONPath( obj, "spec", "tags" ).([]interface{})
+		for _, tag := range tags {
+			sources = append( sources, metadataMap( tag, false, "from" ) )
+		}
+	}
+
+	for _, from := range sources {
+		if _, err := ir.rewriteImageSource( from, fullName, true ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Converts the ImageChange triggers of a deploymentconfig so they remain
+// consistent with the mapped container images. mappedImages holds the
+// mapped image of each container whose image was mapped and exported holds
+// the kind/name of every exported object. A trigger is kept only if the
+// imagestream it names will exist in the target: its image was pushed to
+// the integrated registry, its imagestream is exported, or it is in another
+// namespace (e.g. openshift). Other triggers would block rollouts and are
+// removed.
+func (ir *ImageRewriter) RewriteImageTriggers( obj map[string]interface{}, fullName string, mappedImages map[string]string, exported map[string]struct{} ) error {
+	triggers, _ := GetJSONPath( obj, "spec", "triggers" ).([]interface{})
+	var result []interface{}
+
+	for _, entry := range triggers {
+		trigger, _ := entry.(map[string]interface{})
+		if t, _ := trigger[ "type" ].(string); t != "ImageChange" {
+			result = append( result, entry )
+			continue
+		}
+		params := metadataMap( trigger, false, "imageChangeParams" )
+		from := metadataMap( params, false, "from" )
+		if from == nil {
+			result = append( result, entry )
+			continue
+		}
+		delete( params, "lastTriggeredImage" )
+
+		newRef := ""
+		containers, _ := params[ "containerNames" ].([]interface{})
+		for _, c := range containers {
+			name, _ := c.(string)
+			ref, ok := mappedImages[ name ]
+			if !ok {
+				continue
+			}
+			if newRef != "" && ref != newRef {
+				return fmt.Errorf( "ImageChange trigger of %v covers containers whose images were mapped differently: %q, %q", fullName, newRef, ref )
+			}
+			newRef = ref
+		}
+
+		if newRef == "" {
+			name, _ := from[ "name" ].(string)
+			namespace, _ := from[ "namespace" ].(string)
+			if namespace != "" && namespace != ir.projectName {
+				result = append( result, entry )
+				continue
+			}
+			stream := strings.SplitN( strings.SplitN( name, ":", 2 )[0], "@", 2 )[0]
+			if _, ok := exported[ KIND_IS + "/" + stream ]; !ok {
+				Out.Warn( "Removing ImageChange trigger of %v; imagestream %v is not exported", fullName, stream )
+				continue
+			}
+			delete( from, "namespace" )
+			result = append( result, entry )
+			continue
+		}
+
+		source, ok, err := ir.imageStreamSource( newRef, exported )
+		if err != nil {
+			return fmt.Errorf( "Invalid mapped image reference in %v: %v", fullName, err )
+		}
+		if !ok {
+			Out.Warn( "Removing ImageChange trigger of %v; mapped image %q is not in the integrated registry and its imagestream is not exported", fullName, newRef )
+			continue
+		}
+		if source[ "kind" ] != "ImageStreamTag" {
+			Out.Warn( "Removing ImageChange trigger of %v; mapped image %q has no tag", fullName, newRef )
+			continue
+		}
+
+		Out.Info( "Rewriting ImageChange trigger of %v to ImageStreamTag %v", fullName, source[ "name" ] )
+		replaceMap( from, source )
+		result = append( result, entry )
+	}
+
+	if triggers != nil {
+		if result == nil {
+			result = []interface{}{}
+		}
+		metadataMap( obj, false, "spec" )[ "triggers" ] = result
+	}
+	return nil
+}
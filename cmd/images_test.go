@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func stringPtr( s string ) *string {
+	return &s
+}
+
+func testImageRewriter( mappings... ExportImageMapping ) *ImageRewriter {
+	xr := &XR{}
+	xr.Spec.ExportRules.Transforms.ImageMappings = mappings
+	return NewImageRewriter( xr, "src", ":v1_1" )
+}
+
+func testTriggers( t *testing.T, containers... string ) map[string]interface{} {
+	triggers := `[ { "type": "ConfigChange" }`
+	for _, c := range containers {
+		triggers += `, { "type": "ImageChange", "imageChangeParams": { "containerNames": [ "` + c + `" ], "lastTriggeredImage": "x", "from": { "kind": "ImageStreamTag", "name": "` + c + `:latest", "namespace": "src" } } }`
+	}
+	return parseTestObject( t, `{ "kind": "DeploymentConfig", "spec": { "triggers": ` + triggers + ` ] } }` )
+}
+
+func triggerSources( obj map[string]interface{} ) map[string]map[string]interface{} {
+	sources := map[string]map[string]interface{}{}
+	triggers, _ := GetJSONPath( obj, "spec", "triggers" ).([]interface{})
+	for _, trigger := range triggers {
+		containers, _ := GetJSONPath( trigger, "imageChangeParams", "containerNames" ).([]interface{})
+		if len( containers ) > 0 {
+			sources[ containers[0].(string) ] = metadataMap( trigger, false, "imageChangeParams", "from" )
+		}
+	}
+	return sources
+}
+
+func TestRewriteImageTriggers( t *testing.T ) {
+	ir := testImageRewriter()
+	obj := testTriggers( t, "external", "exported", "integrated", "unmapped", "unexported" )
+	mapped := map[string]string{
+		"external": "quay.io/org/external:v1",
+		"exported": "quay.io/org/exported:v1",
+		"integrated": "image-registry.openshift-image-registry.svc:5000/prod/integrated:v1",
+	}
+	exported := map[string]struct{}{
+		KIND_IS + "/exported": {},
+		KIND_IS + "/unmapped": {},
+	}
+
+	err := ir.RewriteImageTriggers( obj, "deploymentconfigs.apps.openshift.io/app", mapped, exported )
+	if err != nil {
+		t.Fatal( err )
+	}
+
+	sources := triggerSources( obj )
+	if len( sources ) != 3 {
+		t.Errorf( "expected triggers for exported, integrated and unmapped, got %v", sources )
+	}
+	for name, expected := range map[string]map[string]interface{}{
+		"exported": { "kind": "ImageStreamTag", "name": "exported:v1" },
+		"integrated": { "kind": "ImageStreamTag", "name": "integrated:v1", "namespace": "prod" },
+		"unmapped": { "kind": "ImageStreamTag", "name": "unmapped:latest" },
+	} {
+		from := sources[ name ]
+		if len( from ) != len( expected ) {
+			t.Errorf( "%v trigger source %v, expected %v", name, from, expected )
+			continue
+		}
+		for key, value := range expected {
+			if from[ key ] != value {
+				t.Errorf( "%v trigger source %v, expected %v", name, from, expected )
+			}
+		}
+	}
+}
+
+func TestRewriteMutatorImageSources( t *testing.T ) {
+	ir := testImageRewriter( ExportImageMapping{
+		Pattern: "~/*/app:*",
+		SetRegistryHost: stringPtr( "quay.io" ),
+		SetNamespace: stringPtr( "org" ),
+		TagType: "user",
+	})
+	obj := parseTestObject( t, `{
+		"kind": "BuildConfig",
+		"spec": {
+			"strategy": { "dockerStrategy": { "from": { "kind": "ImageStreamTag", "name": "ruby:2.7", "namespace": "openshift" } } },
+			"output": { "to": { "kind": "ImageStreamTag", "name": "app:latest", "namespace": "src" } },
+			"triggers": [
+				{ "type": "ImageChange", "imageChange": { "from": { "kind": "ImageStreamTag", "name": "app:latest" } } },
+				{ "type": "ImageChange", "imageChange": { "from": { "kind": "ImageStreamTag", "name": "base:1", "namespace": "src" } } }
+			]
+		}
+	}` )
+
+	err := ir.RewriteMutatorImageSources( obj, KIND_BC, "buildconfigs.build.openshift.io/app" )
+	if err != nil {
+		t.Fatal( err )
+	}
+
+	if from := metadataMap( obj, false, "spec", "strategy", "dockerStrategy", "from" ); from[ "namespace" ] != "openshift" || from[ "name" ] != "ruby:2.7" {
+		t.Errorf( "unmapped reference to another namespace changed: %v", from )
+	}
+	if to := metadataMap( obj, false, "spec", "output", "to" ); to[ "kind" ] != "DockerImage" || to[ "name" ] != "quay.io/org/app:latest" {
+		t.Errorf( "output was not mapped to the external registry: %v", to )
+	}
+
+	triggers, _ := GetJSONPath( obj, "spec", "triggers" ).([]interface{})
+	if len( triggers ) != 1 {
+		t.Fatalf( "expected only the base trigger to remain, got %v", triggers )
+	}
+	if from := metadataMap( triggers[0], false, "imageChange", "from" ); from[ "name" ] != "base:1" || from[ "namespace" ] != nil {
+		t.Errorf( "unmapped trigger source %v, expected base:1 without namespace", from )
+	}
+}
@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"os"
+	"fmt"
+	"strings"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"k8s.io/client-go/discovery"
+)
+
+// A resource type served by the cluster. Resource names are qualified by
+// group (e.g. "deployments.apps") unless they belong to the core API.
+type ResourceType struct {
+	Resource string `json:"resource"`
+	Group string `json:"group"`
+	Version string `json:"version"`
+	Kind string `json:"kind"`
+	Singular string `json:"singular"`
+	ShortNames []string `json:"shortNames"`
+	Namespaced bool `json:"namespaced"`
+	Verbs []string `json:"verbs"`
+	Categories []string `json:"categories"`
+}
+
+// Returns the name used for the resource type in kind/name strings and
+// as the object directory name.
+func (rt *ResourceType) Name() string {
+	if rt.Group == "" {
+		return rt.Resource
+	}
+	return rt.Resource + "." + rt.Group
+}
+
+// Returns true if name refers to the resource type, ignoring group.
+func (rt *ResourceType) matches( name string ) bool {
+	if name == rt.Resource || name == rt.Singular || name == strings.ToLower( rt.Kind ) {
+		return true
+	}
+	for _, short := range rt.ShortNames {
+		if name == short {
+			return true
+		}
+	}
+	return false
+}
+
+func (rt *ResourceType) HasVerb( verb string ) bool {
+	for _, v := range rt.Verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolves kind names, short names and object kinds to resource types.
+// Types are held in preference order so that ambiguous names (e.g.
+// "deployments") resolve the same way the cluster would.
+type KindResolver struct {
+	types []ResourceType
+	cluster *Cluster // nil when types were not discovered
+}
+
+var kinds *KindResolver
+
+// Returns the resolver for the connected cluster. Without a connection,
+// the mapping cached by the last connected run is used, falling back to a
+// built-in table of common OpenShift resource types.
+func Kinds() *KindResolver {
+	if kinds != nil && ( kinds.cluster == OC || OC == nil ) {
+		return kinds
+	}
+
+	if OC != nil {
+		types, err := discoverResourceTypes( OC.discovery )
+		if err == nil {
+			kinds = &KindResolver{ types: types, cluster: OC }
+			writeKindCache( types )
+			return kinds
+		}
+		Out.Warn( "Unable to discover cluster resource types; using cached mapping: %v", err )
+	}
+
+	if kinds == nil {
+		if types, ok := readKindCache(); ok {
+			kinds = &KindResolver{ types: types }
+		} else {
+			kinds = &KindResolver{ types: builtinResourceTypes }
+		}
+	}
+	return kinds
+}
+
+func discoverResourceTypes( disc discovery.DiscoveryInterface ) ([]ResourceType, error) {
+	lists, err := discovery.ServerPreferredResources( disc )
+	if err != nil && len( lists ) == 0 {
+		return nil, err
+	}
+	if err != nil {
+		// Some API groups may be unavailable (e.g. a broken aggregated API)
+		Out.Debug( "Partial resource discovery: %v", err )
+	}
+
+	var types []ResourceType
+	for _, list := range lists {
+		for _, r := range list.APIResources {
+			if strings.Contains( r.Name, "/" ) {
+				continue // subresource
+			}
+			group, version := "", list.GroupVersion
+			if i := strings.Index( version, "/" ); i >= 0 {
+				group, version = version[:i], version[i+1:]
+			}
+			types = append( types, ResourceType{
+				Resource: r.Name,
+				Group: group,
+				Version: version,
+				Kind: r.Kind,
+				Singular: r.SingularName,
+				ShortNames: r.ShortNames,
+				Namespaced: r.Namespaced,
+				Verbs: r.Verbs,
+				Categories: r.Categories,
+			})
+		}
+	}
+	return types, nil
+}
+
+func kindCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join( dir, "xrutil", "resources.json" )
+}
+
+func readKindCache() ([]ResourceType, bool) {
+	path := kindCachePath()
+	if path == "" {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile( path )
+	if err != nil {
+		return nil, false
+	}
+	var types []ResourceType
+	if err := json.Unmarshal( data, &types ); err != nil || len( types ) == 0 {
+		Out.Warn( "Ignoring unreadable resource type cache (%v): %v", path, err )
+		return nil, false
+	}
+	Out.Debug( "Using cached resource types: %v", path )
+	return types, true
+}
+
+func writeKindCache( types []ResourceType ) {
+	path := kindCachePath()
+	if path == "" {
+		return
+	}
+	data, err := json.MarshalIndent( types, "", "\t" )
+	if err == nil {
+		err = os.MkdirAll( filepath.Dir( path ), 0700 )
+	}
+	if err == nil {
+		err = ioutil.WriteFile( path, data, 0600 )
+	}
+	if err != nil {
+		Out.Debug( "Unable to write resource type cache (%v): %v", path, err )
+	}
+}
+
+// Resolves a resource name, singular name, kind or short name, optionally
+// qualified by group (e.g. "deployments.apps" or "dc").
+func (kr *KindResolver) Resolve( name string ) (*ResourceType, bool) {
+	name = strings.ToLower( strings.TrimSpace( name ) )
+
+	for i := range kr.types {
+		rt := &kr.types[i]
+		if rt.matches( name ) {
+			return rt, true
+		}
+		if rt.Group != "" && strings.HasSuffix( name, "." + rt.Group ) && rt.matches( strings.TrimSuffix( name, "." + rt.Group ) ) {
+			return rt, true
+		}
+	}
+
+	return nil, false
+}
+
+// Resolves an object's apiVersion and kind. Objects exported from older
+// OpenShift releases use the legacy v1 API for types which now live in
+// API groups; those are resolved by kind alone.
+func (kr *KindResolver) ResolveObject( apiVersion string, kind string ) (*ResourceType, bool) {
+	group := ""
+	if i := strings.Index( apiVersion, "/" ); i >= 0 {
+		group = apiVersion[:i]
+	}
+	kind = strings.ToLower( kind )
+
+	for i := range kr.types {
+		if kr.types[i].Group == group && strings.ToLower( kr.types[i].Kind ) == kind {
+			return &kr.types[i], true
+		}
+	}
+
+	if group == "" {
+		for i := range kr.types {
+			if strings.ToLower( kr.types[i].Kind ) == kind {
+				return &kr.types[i], true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// Returns the resource name for an object's apiVersion and kind.
+func ResourceNameForObject( apiVersion string, kind string ) string {
+	if rt, ok := Kinds().ResolveObject( apiVersion, kind ); ok {
+		return rt.Name()
+	}
+	Out.Debug( "Unknown object kind (%v, %v); using it verbatim", apiVersion, kind )
+	return strings.ToLower( kind )
+}
+
+// Returns the resource name for an object definition's apiVersion and kind.
+func ObjectKind( obj interface{} ) string {
+	apiVersion, _ := GetJSONPath( obj, "apiVersion" ).(string)
+	kind, _ := GetJSONPath( obj, "kind" ).(string)
+	return ResourceNameForObject( apiVersion, kind )
+}
+
+// Returns the normalized kind/name of an object definition.
+func ObjectFullName( obj interface{} ) string {
+	name, _ := GetJSONPath( obj, "metadata", "name" ).(string)
+	return ObjectKind( obj ) + "/" + name
+}
+
+// Used when no cluster is reachable and no discovery results have been
+// cached. Order matters for ambiguous names; core types come first.
+var builtinResourceTypes = []ResourceType{
+	{ Resource: "pods", Version: "v1", Kind: "Pod", Singular: "pod", ShortNames: []string{ "po" }, Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "services", Version: "v1", Kind: "Service", Singular: "service", ShortNames: []string{ "svc" }, Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "replicationcontrollers", Version: "v1", Kind: "ReplicationController", Singular: "replicationcontroller", ShortNames: []string{ "rc" }, Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "configmaps", Version: "v1", Kind: "ConfigMap", Singular: "configmap", ShortNames: []string{ "cm" }, Namespaced: true },
+	{ Resource: "secrets", Version: "v1", Kind: "Secret", Singular: "secret", Namespaced: true },
+	{ Resource: "serviceaccounts", Version: "v1", Kind: "ServiceAccount", Singular: "serviceaccount", ShortNames: []string{ "sa" }, Namespaced: true },
+	{ Resource: "persistentvolumeclaims", Version: "v1", Kind: "PersistentVolumeClaim", Singular: "persistentvolumeclaim", ShortNames: []string{ "pvc" }, Namespaced: true },
+	{ Resource: "persistentvolumes", Version: "v1", Kind: "PersistentVolume", Singular: "persistentvolume", ShortNames: []string{ "pv" } },
+	{ Resource: "endpoints", Version: "v1", Kind: "Endpoints", Singular: "endpoints", ShortNames: []string{ "ep" }, Namespaced: true },
+	{ Resource: "events", Version: "v1", Kind: "Event", Singular: "event", ShortNames: []string{ "ev" }, Namespaced: true },
+	{ Resource: "limitranges", Version: "v1", Kind: "LimitRange", Singular: "limitrange", ShortNames: []string{ "limits" }, Namespaced: true },
+	{ Resource: "resourcequotas", Version: "v1", Kind: "ResourceQuota", Singular: "resourcequota", ShortNames: []string{ "quota" }, Namespaced: true },
+	{ Resource: "namespaces", Version: "v1", Kind: "Namespace", Singular: "namespace", ShortNames: []string{ "ns" } },
+	{ Resource: "deployments", Group: "apps", Version: "v1", Kind: "Deployment", Singular: "deployment", ShortNames: []string{ "deploy" }, Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "statefulsets", Group: "apps", Version: "v1", Kind: "StatefulSet", Singular: "statefulset", ShortNames: []string{ "sts" }, Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "daemonsets", Group: "apps", Version: "v1", Kind: "DaemonSet", Singular: "daemonset", ShortNames: []string{ "ds" }, Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "replicasets", Group: "apps", Version: "v1", Kind: "ReplicaSet", Singular: "replicaset", ShortNames: []string{ "rs" }, Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "horizontalpodautoscalers", Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler", Singular: "horizontalpodautoscaler", ShortNames: []string{ "hpa" }, Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "jobs", Group: "batch", Version: "v1", Kind: "Job", Singular: "job", Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "cronjobs", Group: "batch", Version: "v1", Kind: "CronJob", Singular: "cronjob", ShortNames: []string{ "cj" }, Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "ingresses", Group: "networking.k8s.io", Version: "v1", Kind: "Ingress", Singular: "ingress", ShortNames: []string{ "ing" }, Namespaced: true },
+	{ Resource: "networkpolicies", Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy", Singular: "networkpolicy", ShortNames: []string{ "netpol" }, Namespaced: true },
+	{ Resource: "poddisruptionbudgets", Group: "policy", Version: "v1", Kind: "PodDisruptionBudget", Singular: "poddisruptionbudget", ShortNames: []string{ "pdb" }, Namespaced: true },
+	{ Resource: "roles", Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "Role", Singular: "role", Namespaced: true },
+	{ Resource: "rolebindings", Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding", Singular: "rolebinding", Namespaced: true },
+	{ Resource: "events", Group: "events.k8s.io", Version: "v1", Kind: "Event", Singular: "event", ShortNames: []string{ "ev" }, Namespaced: true },
+	{ Resource: "endpointslices", Group: "discovery.k8s.io", Version: "v1", Kind: "EndpointSlice", Singular: "endpointslice", Namespaced: true },
+	{ Resource: "deploymentconfigs", Group: "apps.openshift.io", Version: "v1", Kind: "DeploymentConfig", Singular: "deploymentconfig", ShortNames: []string{ "dc" }, Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "buildconfigs", Group: "build.openshift.io", Version: "v1", Kind: "BuildConfig", Singular: "buildconfig", ShortNames: []string{ "bc" }, Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "builds", Group: "build.openshift.io", Version: "v1", Kind: "Build", Singular: "build", Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "imagestreams", Group: "image.openshift.io", Version: "v1", Kind: "ImageStream", Singular: "imagestream", ShortNames: []string{ "is" }, Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "imagestreamtags", Group: "image.openshift.io", Version: "v1", Kind: "ImageStreamTag", Singular: "imagestreamtag", ShortNames: []string{ "istag" }, Namespaced: true },
+	{ Resource: "routes", Group: "route.openshift.io", Version: "v1", Kind: "Route", Singular: "route", Namespaced: true, Categories: []string{ "all" } },
+	{ Resource: "templates", Group: "template.openshift.io", Version: "v1", Kind: "Template", Singular: "template", Namespaced: true },
+}
+
+// Returns the namespaced resource types which can be listed, read and
+// recreated, in discovery order. Requires types discovered from the
+// connected cluster since the cached and built-in tables may be stale.
+func (kr *KindResolver) ExportableTypes() ([]ResourceType, error) {
+	if kr.cluster == nil {
+		return nil, fmt.Errorf( "Resource types could not be discovered from the cluster" )
+	}
+
+	var types []ResourceType
+	for _, rt := range kr.types {
+		if rt.Namespaced && rt.HasVerb( "list" ) && rt.HasVerb( "get" ) && rt.HasVerb( "create" ) {
+			types = append( types, rt )
+		}
+	}
+	return types, nil
+}
@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"bytes"
+	"io/ioutil"
+	"text/template"
+	"encoding/json"
+)
+
+// Adds, overrides or removes labels or annotations of imported objects
+// selected by Match (every object when empty). Set values are templates
+// which may reference {{.Version}}, {{.Name}} (the XR) and {{.Namespace}}.
+type MetadataRule struct {
+	Match string `json:"match"`
+	Set map[string]string `json:"set"`
+	Remove []string `json:"remove"`
+}
+
+// The values available to MetadataRule templates.
+type MetadataContext struct {
+	Version string
+	Name string
+	Namespace string
+}
+
+type renderedMetadataRule struct {
+	match string
+	set map[string]string
+	remove []string
+}
+
+type MetadataTransform struct {
+	labels []renderedMetadataRule
+	annotations []renderedMetadataRule
+}
+
+func renderMetadataRules( rules []MetadataRule, ctx MetadataContext ) ([]renderedMetadataRule, error) {
+	var rendered []renderedMetadataRule
+	for _, rule := range rules {
+		r := renderedMetadataRule{ match: rule.Match, set: map[string]string{}, remove: rule.Remove }
+		for key, value := range rule.Set {
+			t, err := template.New( key ).Option( "missingkey=error" ).Parse( value )
+			if err != nil {
+				return nil, fmt.Errorf( "Invalid value template for %v: %v", key, err )
+			}
+			var out bytes.Buffer
+			err = t.Execute( &out, ctx )
+			if err != nil {
+				return nil, fmt.Errorf( "Unable to render value for %v: %v", key, err )
+			}
+			r.set[ key ] = out.String()
+		}
+		rendered = append( rendered, r )
+	}
+	return rendered, nil
+}
+
+// Builds the transform from the XR's import label and annotation rules.
+func NewMetadataTransform( xr *XR, ctx MetadataContext ) (*MetadataTransform, error) {
+	transforms := xr.Spec.ImportRules.Transforms
+	labels, err := renderMetadataRules( transforms.Labels, ctx )
+	if err != nil {
+		return nil, fmt.Errorf( "Invalid label rule: %v", err )
+	}
+	annotations, err := renderMetadataRules( transforms.Annotations, ctx )
+	if err != nil {
+		return nil, fmt.Errorf( "Invalid annotation rule: %v", err )
+	}
+	return &MetadataTransform{ labels: labels, annotations: annotations }, nil
+}
+
+func (r *renderedMetadataRule) matches( fullName string ) bool {
+	return r.match == "" || IsMatchedByKindNameList( fullName, r.match )
+}
+
+// Returns the map at the path, creating it and any missing parents if
+// create is set. Returns nil if the map does not exist and create is not
+// set.
+func metadataMap( obj interface{}, create bool, path... string ) map[string]interface{} {
+	m, _ := obj.(map[string]interface{})
+	for _, name := range path {
+		if m == nil {
+			return nil
+		}
+		next, ok := m[ name ].(map[string]interface{})
+		if !ok && create {
+			next = map[string]interface{}{}
+			m[ name ] = next
+		}
+		m = next
+	}
+	return m
+}
+
+// Paths of the pod templates within workload objects.
+var podTemplatePaths = [][]string{
+	{ "spec", "template" },
+	{ "spec", "jobTemplate", "spec", "template" },
+}
+
+// Returns the label selectors of an object: a plain map for services,
+// deploymentconfigs and replicationcontrollers, matchLabels otherwise.
+func objectSelectors( obj interface{} ) []map[string]interface{} {
+	var selectors []map[string]interface{}
+	for _, path := range [][]string{ { "spec", "selector" }, { "spec", "jobTemplate", "spec", "selector" } } {
+		selector, ok := GetJSONPath( obj, path... ).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if matchLabels, ok := selector[ "matchLabels" ].(map[string]interface{}); ok {
+			selectors = append( selectors, matchLabels )
+		} else if _, ok := selector[ "matchExpressions" ]; !ok {
+			selectors = append( selectors, selector )
+		}
+	}
+	return selectors
+}
+
+// The selectors and pod template labels of an object to be imported.
+type selectorIndexEntry struct {
+	fullName string
+	selectors []map[string]interface{}
+	templates []map[string]interface{}
+}
+
+func readSelectorIndex( files map[string]string ) ([]selectorIndexEntry, error) {
+	var index []selectorIndexEntry
+	for fullName, filename := range files {
+		data, err := ioutil.ReadFile( filename )
+		if err != nil {
+			return nil, fmt.Errorf( "Error reading %v: %v", filename, err )
+		}
+		var obj interface{}
+		err = json.Unmarshal( data, &obj )
+		if err != nil {
+			return nil, fmt.Errorf( "Error parsing %v: %v", filename, err )
+		}
+		entry := selectorIndexEntry{ fullName: fullName, selectors: objectSelectors( obj ) }
+		for _, path := range podTemplatePaths {
+			if podTemplate := GetJSONPath( obj, path... ); podTemplate != nil {
+				labels := metadataMap( podTemplate, false, "metadata", "labels" )
+				if labels == nil {
+					labels = map[string]interface{}{}
+				}
+				entry.templates = append( entry.templates, labels )
+			}
+		}
+		index = append( index, entry )
+	}
+	sort.Slice( index, func( i, j int ) bool { return index[i].fullName < index[j].fullName } )
+	return index, nil
+}
+
+func selectsLabels( selector map[string]interface{}, labels map[string]interface{} ) bool {
+	if len( selector ) == 0 {
+		return false
+	}
+	for key, value := range selector {
+		if labels[ key ] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks that no label rule separates a selector from the pods it selects.
+// A rule must match an object whose selector it changes together with the
+// workloads whose pods that selector selects, and a workload whose pod
+// labels it changes together with the objects selecting those pods. files
+// holds the object files to be imported.
+func (mt *MetadataTransform) Validate( files map[string]string ) error {
+	index, err := readSelectorIndex( files )
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range mt.labels {
+		changes := map[string]*string{} // label key => new value, or nil if removed
+		for key := range rule.set {
+			value := rule.set[ key ]
+			changes[ key ] = &value
+		}
+		for _, key := range rule.remove {
+			changes[ key ] = nil
+		}
+
+		for _, selecting := range index {
+			for _, workload := range index {
+				if selecting.fullName == workload.fullName {
+					continue // an object's own selector and pods change together
+				}
+				selectingMatched := rule.matches( selecting.fullName )
+				workloadMatched := rule.matches( workload.fullName )
+				if selectingMatched == workloadMatched {
+					continue
+				}
+				for _, selector := range selecting.selectors {
+					for _, labels := range workload.templates {
+						if ! selectsLabels( selector, labels ) {
+							continue
+						}
+						for key, value := range changes {
+							if _, ok := selector[ key ]; !ok {
+								continue
+							}
+							if value == nil && ! workloadMatched {
+								continue // removal does not touch selectors
+							}
+							if value == nil && workloadUsesLabel( workload, key ) {
+								continue // kept on pod templates; see Apply
+							}
+							if value != nil && *value == selector[ key ] {
+								continue
+							}
+							changed, unchanged := selecting.fullName, workload.fullName
+							if workloadMatched {
+								changed, unchanged = unchanged, changed
+							}
+							return fmt.Errorf( "Label rule %q changes label %v of %v but not of %v; the selector of %v would no longer select the pods of %v", rule.match, key, changed, unchanged, selecting.fullName, workload.fullName )
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func workloadUsesLabel( entry selectorIndexEntry, key string ) bool {
+	for _, selector := range entry.selectors {
+		if _, ok := selector[ key ]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies the rules to an object. Labels are set on the object and its pod
+// templates; selectors which already use a label follow a new value so the
+// object keeps selecting its pods. Labels used by a selector are not removed
+// from pod templates.
+func (mt *MetadataTransform) Apply( fullName string, obj map[string]interface{} ) {
+	for _, rule := range mt.labels {
+		if ! rule.matches( fullName ) {
+			continue
+		}
+		selectors := objectSelectors( obj )
+		for key, value := range rule.set {
+			metadataMap( obj, true, "metadata", "labels" )[ key ] = value
+			for _, path := range podTemplatePaths {
+				if podTemplate := GetJSONPath( obj, path... ); podTemplate != nil {
+					metadataMap( podTemplate, true, "metadata", "labels" )[ key ] = value
+				}
+			}
+			for _, selector := range selectors {
+				if _, ok := selector[ key ]; ok {
+					selector[ key ] = value
+				}
+			}
+		}
+		for _, key := range rule.remove {
+			delete( metadataMap( obj, false, "metadata", "labels" ), key )
+			selected := false
+			for _, selector := range selectors {
+				_, ok := selector[ key ]
+				selected = selected || ok
+			}
+			if selected {
+				Out.Warn( "Not removing label %v from pod template of %v; it is used by a selector", key, fullName )
+				continue
+			}
+			for _, path := range podTemplatePaths {
+				if podTemplate := GetJSONPath( obj, path... ); podTemplate != nil {
+					delete( metadataMap( podTemplate, false, "metadata", "labels" ), key )
+				}
+			}
+		}
+	}
+
+	for _, rule := range mt.annotations {
+		if ! rule.matches( fullName ) {
+			continue
+		}
+		for key, value := range rule.set {
+			metadataMap( obj, true, "metadata", "annotations" )[ key ] = value
+		}
+		for _, key := range rule.remove {
+			delete( metadataMap( obj, false, "metadata", "annotations" ), key )
+		}
+	}
+}
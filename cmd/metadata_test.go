@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func writeTestFiles( t *testing.T, objects map[string]string ) map[string]string {
+	dir := t.TempDir()
+	files := map[string]string{}
+	i := 0
+	for fullName, data := range objects {
+		filename := filepath.Join( dir, string( rune( 'a' + i ) ) + ".json" )
+		if err := ioutil.WriteFile( filename, []byte( data ), 0600 ); err != nil {
+			t.Fatal( err )
+		}
+		files[ fullName ] = filename
+		i++
+	}
+	return files
+}
+
+func TestMetadataTransformValidate( t *testing.T ) {
+	useBuiltinKinds( t )
+	files := writeTestFiles( t, map[string]string{
+		KIND_SERVICE + "/web": `{ "kind": "Service", "spec": { "selector": { "app": "web" } } }`,
+		KIND_DC + "/web": `{ "kind": "DeploymentConfig", "spec": { "selector": { "app": "web" }, "template": { "metadata": { "labels": { "app": "web" } } } } }`,
+	})
+
+	cases := []struct {
+		rule MetadataRule
+		valid bool
+	}{
+		{ MetadataRule{ Set: map[string]string{ "app": "new" } }, true },
+		{ MetadataRule{ Match: KIND_SERVICE + "/web," + KIND_DC + "/web", Set: map[string]string{ "app": "new" } }, true },
+		{ MetadataRule{ Match: KIND_SERVICE + "/web", Set: map[string]string{ "team": "a" } }, true },
+		{ MetadataRule{ Match: KIND_SERVICE + "/web", Set: map[string]string{ "app": "web" } }, true },
+		{ MetadataRule{ Match: KIND_SERVICE + "/web", Remove: []string{ "app" } }, true },
+		// The dc's own selector uses the label, so its pods keep it
+		{ MetadataRule{ Match: KIND_DC + "/web", Remove: []string{ "app" } }, true },
+		{ MetadataRule{ Match: KIND_SERVICE + "/web", Set: map[string]string{ "app": "new" } }, false },
+		{ MetadataRule{ Match: KIND_DC + "/web", Set: map[string]string{ "app": "new" } }, false },
+	}
+
+	for _, tc := range cases {
+		xr := &XR{}
+		xr.Spec.ImportRules.Transforms.Labels = []MetadataRule{ tc.rule }
+		mt, err := NewMetadataTransform( xr, MetadataContext{} )
+		if err != nil {
+			t.Fatal( err )
+		}
+		err = mt.Validate( files )
+		if ( err == nil ) != tc.valid {
+			t.Errorf( "Validate(%+v) = %v, expected valid=%v", tc.rule, err, tc.valid )
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Structured changes to imported workloads selected by Match. Resources
+// and Env are keyed by container name; every named container must exist.
+type WorkloadOverride struct {
+	Match string `json:"match"`
+	Replicas *int64 `json:"replicas"`
+	Resources map[string]struct {
+		Limits map[string]string `json:"limits"`
+		Requests map[string]string `json:"requests"`
+	} `json:"resources"`
+	Env map[string]struct {
+		Set map[string]string `json:"set"`
+		Unset []string `json:"unset"`
+	} `json:"env"`
+}
+
+// Kinds whose spec.replicas sets the number of pods.
+var replicatedKinds = map[string]struct{}{
+	KIND_DC: {},
+	KIND_RC: {},
+	KIND_DEPLOYMENT: {},
+	KIND_STATEFULSET: {},
+	KIND_REPLICASET: {},
+}
+
+// Checks override values which do not depend on the objects.
+func ValidateWorkloadOverrides( overrides []WorkloadOverride ) error {
+	for _, o := range overrides {
+		if o.Match == "" {
+			return fmt.Errorf( "Workload override must specify match" )
+		}
+		if o.Replicas != nil && *o.Replicas < 0 {
+			return fmt.Errorf( "Workload override %v: replicas must not be negative", o.Match )
+		}
+		for container, r := range o.Resources {
+			for _, quantities := range []map[string]string{ r.Limits, r.Requests } {
+				for name, q := range quantities {
+					if _, err := resource.ParseQuantity( q ); err != nil {
+						return fmt.Errorf( "Workload override %v: invalid %v quantity for container %v: %q", o.Match, name, container, q )
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the containers of an object's pod template by name, or nil if
+// the object has no pod template.
+func podTemplateContainers( obj interface{} ) map[string]map[string]interface{} {
+	for _, path := range podTemplatePaths {
+		podSpec, ok := GetJSONPath( obj, append( append( []string{}, path... ), "spec" )... ).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		containers := map[string]map[string]interface{}{}
+		for _, field := range []string{ "containers", "initContainers" } {
+			list, _ := podSpec[ field ].([]interface{})
+			for _, c := range list {
+				if m, ok := c.(map[string]interface{}); ok {
+					name, _ := m[ "name" ].(string)
+					containers[ name ] = m
+				}
+			}
+		}
+		return containers
+	}
+	return nil
+}
+
+// Applies the overrides matching an object. Returns an error if an override
+// names a container the workload does not have or sets replicas on a kind
+// without them. matched counts the objects each override applied to.
+func ApplyWorkloadOverrides( overrides []WorkloadOverride, fullName string, obj map[string]interface{}, matched []int ) error {
+	kind := strings.SplitN( fullName, "/", 2 )[0]
+
+	for i, o := range overrides {
+		if ! IsMatchedByKindNameList( fullName, o.Match ) {
+			continue
+		}
+		containers := podTemplateContainers( obj )
+		if containers == nil {
+			Out.Debug( "Workload override %v does not apply to %v; it has no pod template", o.Match, fullName )
+			continue
+		}
+		matched[i]++
+
+		if o.Replicas != nil {
+			if _, ok := replicatedKinds[ kind ]; !ok {
+				return fmt.Errorf( "Workload override %v sets replicas but %v does not have replicas", o.Match, fullName )
+			}
+			Out.Info( "Setting replicas of %v to %v", fullName, *o.Replicas )
+			metadataMap( obj, true, "spec" )[ "replicas" ] = *o.Replicas
+		}
+
+		for name, r := range o.Resources {
+			container, ok := containers[ name ]
+			if !ok {
+				return fmt.Errorf( "Workload override %v: %v has no container named %v (has %v)", o.Match, fullName, name, containerNames( containers ) )
+			}
+			for field, quantities := range map[string]map[string]string{ "limits": r.Limits, "requests": r.Requests } {
+				for resourceName, q := range quantities {
+					metadataMap( container, true, "resources", field )[ resourceName ] = q
+				}
+			}
+			Out.Info( "Setting resources of container %v in %v", name, fullName )
+		}
+
+		for name, e := range o.Env {
+			container, ok := containers[ name ]
+			if !ok {
+				return fmt.Errorf( "Workload override %v: %v has no container named %v (has %v)", o.Match, fullName, name, containerNames( containers ) )
+			}
+			env, _ := container[ "env" ].([]interface{})
+			unset := map[string]struct{}{}
+			for _, n := range e.Unset {
+				unset[ n ] = struct{}{}
+			}
+
+			var result []interface{}
+			seen := map[string]struct{}{}
+			for _, entry := range env {
+				m, _ := entry.(map[string]interface{})
+				n, _ := m[ "name" ].(string)
+				if _, ok := unset[ n ]; ok {
+					continue
+				}
+				if v, ok := e.Set[ n ]; ok {
+					// Replaces a valueFrom reference as well as a value
+					m = map[string]interface{}{ "name": n, "value": v }
+					seen[ n ] = struct{}{}
+				}
+				result = append( result, m )
+			}
+
+			var added []string
+			for n := range e.Set {
+				if _, ok := seen[ n ]; !ok {
+					added = append( added, n )
+				}
+			}
+			sort.Strings( added )
+			for _, n := range added {
+				result = append( result, map[string]interface{}{ "name": n, "value": e.Set[ n ] } )
+			}
+
+			if len( result ) == 0 {
+				delete( container, "env" )
+			} else {
+				container[ "env" ] = result
+			}
+			Out.Info( "Setting environment of container %v in %v", name, fullName )
+		}
+	}
+	return nil
+}
+
+func containerNames( containers map[string]map[string]interface{} ) string {
+	var names []string
+	for name := range containers {
+		names = append( names, name )
+	}
+	sort.Strings( names )
+	return strings.Join( names, ", " )
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"encoding/json"
+)
+
+const testWorkload = `{
+	"kind": "Deployment",
+	"metadata": { "name": "web" },
+	"spec": {
+		"replicas": 1,
+		"template": { "spec": {
+			"initContainers": [ { "name": "migrate" } ],
+			"containers": [ { "name": "app", "env": [
+				{ "name": "LOG_LEVEL", "value": "debug" },
+				{ "name": "DB_PASSWORD", "valueFrom": { "secretKeyRef": { "name": "db", "key": "password" } } },
+				{ "name": "LEGACY", "value": "1" }
+			] } ]
+		} }
+	}
+}`
+
+func parseTestOverrides( t *testing.T, data string ) []WorkloadOverride {
+	var overrides []WorkloadOverride
+	if err := json.Unmarshal( []byte( data ), &overrides ); err != nil {
+		t.Fatal( err )
+	}
+	return overrides
+}
+
+// Returns an object as it would be written to and read from a file.
+func normalizeTestObject( t *testing.T, obj interface{} ) map[string]interface{} {
+	data, err := json.Marshal( obj )
+	if err != nil {
+		t.Fatal( err )
+	}
+	return parseTestObject( t, string( data ) )
+}
+
+func TestValidateWorkloadOverrides( t *testing.T ) {
+	cases := []struct {
+		overrides string
+		valid bool
+	}{
+		{ `[ { "match": "deployments.apps/web", "replicas": 2, "resources": { "app": { "limits": { "cpu": "500m", "memory": "1Gi" } } } } ]`, true },
+		{ `[ { "replicas": 2 } ]`, false },
+		{ `[ { "match": "deployments.apps/web", "replicas": -1 } ]`, false },
+		{ `[ { "match": "deployments.apps/web", "resources": { "app": { "requests": { "memory": "lots" } } } } ]`, false },
+	}
+	for _, tc := range cases {
+		err := ValidateWorkloadOverrides( parseTestOverrides( t, tc.overrides ) )
+		if ( err == nil ) != tc.valid {
+			t.Errorf( "ValidateWorkloadOverrides(%v): error %v", tc.overrides, err )
+		}
+	}
+}
+
+func TestApplyWorkloadOverrides( t *testing.T ) {
+	useBuiltinKinds( t )
+	cases := []struct {
+		name string
+		overrides string
+		fullName string
+		expected string // path => value; empty for an error
+	}{
+		{ "replicas", `[ { "match": "deployments.apps", "replicas": 3 } ]`, KIND_DEPLOYMENT + "/web",
+			`{ "spec.replicas": 3 }` },
+		{ "resources", `[ { "match": "deployments.apps/web", "resources": { "migrate": { "limits": { "cpu": "1" }, "requests": { "cpu": "100m" } } } } ]`, KIND_DEPLOYMENT + "/web",
+			`{ "spec.template.spec.initContainers[0].resources": { "limits": { "cpu": "1" }, "requests": { "cpu": "100m" } } }` },
+		// Set replaces values and valueFrom references in place and appends new names in order
+		{ "env", `[ { "match": "deployments.apps/web", "env": { "app": { "set": { "DB_PASSWORD": "dev", "Z": "z", "A": "a" }, "unset": [ "LEGACY" ] } } } ]`, KIND_DEPLOYMENT + "/web",
+			`{ "spec.template.spec.containers[0].env": [
+				{ "name": "LOG_LEVEL", "value": "debug" },
+				{ "name": "DB_PASSWORD", "value": "dev" },
+				{ "name": "A", "value": "a" },
+				{ "name": "Z", "value": "z" }
+			] }` },
+		{ "unset all", `[ { "match": "deployments.apps/web", "env": { "app": { "unset": [ "LOG_LEVEL", "DB_PASSWORD", "LEGACY" ] } } } ]`, KIND_DEPLOYMENT + "/web",
+			`{ "spec.template.spec.containers[0].env": null }` },
+		{ "missing env container", `[ { "match": "deployments.apps/web", "env": { "sidecar": { "set": { "A": "a" } } } } ]`, KIND_DEPLOYMENT + "/web", "" },
+		{ "missing resources container", `[ { "match": "deployments.apps/web", "resources": { "sidecar": { "limits": { "cpu": "1" } } } } ]`, KIND_DEPLOYMENT + "/web", "" },
+		{ "replicas without replicas", `[ { "match": "daemonsets.apps", "replicas": 3 } ]`, "daemonsets.apps/web", "" },
+	}
+	for _, tc := range cases {
+		obj := parseTestObject( t, testWorkload )
+		matched := make( []int, 1 )
+		err := ApplyWorkloadOverrides( parseTestOverrides( t, tc.overrides ), tc.fullName, obj, matched )
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf( "%v: expected an error", tc.name )
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf( "%v: %v", tc.name, err )
+			continue
+		}
+		if matched[0] != 1 {
+			t.Errorf( "%v: matched %v objects, expected 1", tc.name, matched[0] )
+		}
+		obj = normalizeTestObject( t, obj )
+		for path, expected := range parseTestObject( t, tc.expected ) {
+			fp, err := ParseFieldPath( path )
+			if err != nil {
+				t.Fatal( err )
+			}
+			var value interface{}
+			if values := fp.Values( obj ); len( values ) > 0 {
+				value = values[0]
+			}
+			if !reflect.DeepEqual( value, expected ) {
+				t.Errorf( "%v: %v = %v, expected %v", tc.name, path, value, expected )
+			}
+		}
+	}
+
+	// Objects without a pod template are not counted as matched
+	matched := make( []int, 1 )
+	overrides := parseTestOverrides( t, `[ { "match": "configmaps", "replicas": 1 } ]` )
+	if err := ApplyWorkloadOverrides( overrides, KIND_CONFIGMAP + "/settings", parseTestObject( t, `{ "data": {} }` ), matched ); err != nil || matched[0] != 0 {
+		t.Errorf( "override applied to a configmap: %v, matched %v", err, matched[0] )
+	}
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"io/ioutil"
+	"encoding/json"
+
+	"sigs.k8s.io/yaml"
+)
+
+// A value which differs between environments. On export, each target is
+// replaced by a ${NAME} placeholder (${{NAME}} for non-string values); on
+// import, placeholders are filled in from --values files or Default.
+type Parameter struct {
+	Name string `json:"name"`
+	Description string `json:"description"`
+	Default *string `json:"default"`
+	Targets []struct {
+		Match string `json:"match"`
+		Path string `json:"path"`
+	} `json:"targets"`
+}
+
+var parameterNamePattern = regexp.MustCompile( `^[A-Za-z_][A-Za-z0-9_]*$` )
+
+// Matches ${NAME} and ${{NAME}}
+var parameterRefPattern = regexp.MustCompile( `\$\{(\{?)([A-Za-z_][A-Za-z0-9_]*)\}(\}?)` )
+
+type parameterTarget struct {
+	param string
+	match string
+	path *FieldPath
+}
+
+// Introduces parameter placeholders into exported objects.
+type Parameterizer struct {
+	targets []parameterTarget
+	counts []int
+}
+
+func NewParameterizer( xr *XR ) (*Parameterizer, error) {
+	pz := &Parameterizer{}
+	for _, param := range xr.Spec.Parameters {
+		if ! parameterNamePattern.MatchString( param.Name ) {
+			return nil, fmt.Errorf( "Invalid parameter name: %q", param.Name )
+		}
+		for _, target := range param.Targets {
+			path, err := ParseFieldPath( target.Path )
+			if err != nil {
+				return nil, fmt.Errorf( "Parameter %v: %v", param.Name, err )
+			}
+			pz.targets = append( pz.targets, parameterTarget{ param: param.Name, match: target.Match, path: path } )
+		}
+	}
+	pz.counts = make( []int, len( pz.targets ) )
+	return pz, nil
+}
+
+func (pz *Parameterizer) Apply( fullName string, obj map[string]interface{} ) {
+	for i, target := range pz.targets {
+		if ! IsMatchedByKindNameList( fullName, target.match ) {
+			continue
+		}
+		n := target.path.Replace( obj, func( v interface{} ) interface{} {
+			if _, ok := v.(string); ok {
+				return "${" + target.param + "}"
+			}
+			return "${{" + target.param + "}}"
+		})
+		if n > 0 {
+			Out.Info( "Parameterized %v in %v as %v", target.path, fullName, target.param )
+		}
+		pz.counts[i] += n
+	}
+}
+
+// Warns about parameter targets which did not match any exported field.
+func (pz *Parameterizer) ReportUnused() {
+	for i, target := range pz.targets {
+		if pz.counts[i] == 0 {
+			Out.Warn( "Parameter %v target %v %v did not match any exported field", target.param, target.match, target.path )
+		}
+	}
+}
+
+// Returns the value of each declared parameter from its default and the
+// values files, later files taking precedence. Parameters without a value
+// are absent from the result.
+func LoadParameterValues( xr *XR, files []string ) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	declared := map[string]struct{}{}
+
+	for _, param := range xr.Spec.Parameters {
+		declared[ param.Name ] = struct{}{}
+		if param.Default != nil {
+			values[ param.Name ] = *param.Default
+		}
+	}
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile( file )
+		if err != nil {
+			return nil, fmt.Errorf( "Unable to read values file (%v): %v", file, err )
+		}
+		var fileValues map[string]interface{}
+		err = yaml.Unmarshal( data, &fileValues )
+		if err != nil {
+			return nil, fmt.Errorf( "Unable to parse values file (%v): %v", file, err )
+		}
+		for name, value := range fileValues {
+			if _, ok := declared[ name ]; !ok {
+				return nil, fmt.Errorf( "Values file (%v) sets undeclared parameter: %v", file, name )
+			}
+			values[ name ] = value
+		}
+	}
+
+	return values, nil
+}
+
+// Replaces the placeholders of declared parameters in an object definition.
+// A string consisting only of ${{NAME}} is replaced by the typed value.
+// Returns the names of referenced parameters which have no value.
+func SubstituteParameters( xr *XR, obj interface{}, values map[string]interface{} ) (interface{}, []string) {
+	declared := map[string]struct{}{}
+	for _, param := range xr.Spec.Parameters {
+		declared[ param.Name ] = struct{}{}
+	}
+
+	missing := map[string]struct{}{}
+	var substitute func( v interface{} ) interface{}
+	substitute = func( v interface{} ) interface{} {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for key, e := range t {
+				t[ key ] = substitute( e )
+			}
+			return t
+		case []interface{}:
+			for i, e := range t {
+				t[i] = substitute( e )
+			}
+			return t
+		case string:
+			if m := parameterRefPattern.FindStringSubmatch( t ); m != nil && m[0] == t && m[1] == "{" && m[3] == "}" {
+				if _, ok := declared[ m[2] ]; ok {
+					value, ok := values[ m[2] ]
+					if !ok {
+						missing[ m[2] ] = struct{}{}
+						return t
+					}
+					return typedParameterValue( value )
+				}
+			}
+			return parameterRefPattern.ReplaceAllStringFunc( t, func( ref string ) string {
+				m := parameterRefPattern.FindStringSubmatch( ref )
+				if len( m[1] ) != len( m[3] ) {
+					return ref
+				}
+				if _, ok := declared[ m[2] ]; !ok {
+					return ref // e.g. a shell variable within a script
+				}
+				value, ok := values[ m[2] ]
+				if !ok {
+					missing[ m[2] ] = struct{}{}
+					return ref
+				}
+				return fmt.Sprint( value )
+			})
+		}
+		return v
+	}
+
+	obj = substitute( obj )
+
+	var names []string
+	for name := range missing {
+		names = append( names, name )
+	}
+	return obj, names
+}
+
+// Values from YAML files are already typed; defaults are strings holding
+// JSON (e.g. "3" or "true") or plain text.
+func typedParameterValue( value interface{} ) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	var typed interface{}
+	if err := json.Unmarshal( []byte( strings.TrimSpace( s ) ), &typed ); err == nil {
+		return typed
+	}
+	return s
+}
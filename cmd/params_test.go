@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+	"encoding/json"
+)
+
+func testParameterXR( names... string ) *XR {
+	xr := &XR{}
+	for _, name := range names {
+		xr.Spec.Parameters = append( xr.Spec.Parameters, Parameter{ Name: name } )
+	}
+	return xr
+}
+
+func TestSubstituteParameters( t *testing.T ) {
+	xr := testParameterXR( "HOST", "REPLICAS", "DEBUG", "UNSET" )
+	values := map[string]interface{}{ "HOST": "db.example.com", "REPLICAS": "3", "DEBUG": true }
+
+	cases := []struct {
+		obj string
+		expected string
+		missing []string
+	}{
+		{ `{ "host": "${HOST}" }`, `{ "host": "db.example.com" }`, nil },
+		{ `{ "url": "postgres://${HOST}:5432/${HOST}" }`, `{ "url": "postgres://db.example.com:5432/db.example.com" }`, nil },
+		// A typed placeholder alone takes the type of the value
+		{ `{ "replicas": "${{REPLICAS}}", "debug": "${{DEBUG}}" }`, `{ "replicas": 3, "debug": true }`, nil },
+		{ `{ "args": [ "--replicas=${{REPLICAS}}", "${HOST}" ] }`, `{ "args": [ "--replicas=3", "db.example.com" ] }`, nil },
+		// Undeclared references and mismatched braces are left alone
+		{ `{ "script": "echo ${HOME} ${{HOST} ${HOST}}" }`, `{ "script": "echo ${HOME} ${{HOST} ${HOST}}" }`, nil },
+		{ `{ "a": "${UNSET}", "b": [ "${{UNSET}}" ] }`, `{ "a": "${UNSET}", "b": [ "${{UNSET}}" ] }`, []string{ "UNSET" } },
+	}
+	for _, tc := range cases {
+		obj, missing := SubstituteParameters( xr, parseTestObject( t, tc.obj ), values )
+		if expected := parseTestObject( t, tc.expected ); !reflect.DeepEqual( obj, expected ) {
+			t.Errorf( "SubstituteParameters(%v) = %v, expected %v", tc.obj, obj, expected )
+		}
+		if !reflect.DeepEqual( missing, tc.missing ) {
+			t.Errorf( "SubstituteParameters(%v) missing %v, expected %v", tc.obj, missing, tc.missing )
+		}
+	}
+}
+
+func TestParameterizer( t *testing.T ) {
+	useBuiltinKinds( t )
+	xr := &XR{}
+	err := json.Unmarshal( []byte( `{ "spec": { "parameters": [
+		{ "name": "HOST", "targets": [ { "match": "configmaps", "path": "data.host" } ] },
+		{ "name": "REPLICAS", "targets": [ { "match": "deployments.apps", "path": "spec.replicas" } ] }
+	] } }` ), xr )
+	if err != nil {
+		t.Fatal( err )
+	}
+
+	pz, err := NewParameterizer( xr )
+	if err != nil {
+		t.Fatal( err )
+	}
+
+	cm := parseTestObject( t, `{ "data": { "host": "db.internal" } }` )
+	deployment := parseTestObject( t, `{ "spec": { "replicas": 2 } }` )
+	pz.Apply( KIND_CONFIGMAP + "/settings", cm )
+	pz.Apply( KIND_DEPLOYMENT + "/web", deployment )
+	if host := GetJSONPath( cm, "data", "host" ); host != "${HOST}" {
+		t.Errorf( "host = %v", host )
+	}
+	if replicas := GetJSONPath( deployment, "spec", "replicas" ); replicas != "${{REPLICAS}}" {
+		t.Errorf( "replicas = %v", replicas )
+	}
+
+	// Exported placeholders are filled in again on import
+	obj, missing := SubstituteParameters( xr, deployment, map[string]interface{}{ "REPLICAS": 2.0 } )
+	if replicas := GetJSONPath( obj, "spec", "replicas" ); replicas != 2.0 || len( missing ) != 0 {
+		t.Errorf( "replicas = %v, missing %v", replicas, missing )
+	}
+
+	if _, err := NewParameterizer( testParameterXR( "1BAD" ) ); err == nil {
+		t.Error( "expected an invalid parameter name to be rejected" )
+	}
+}
+
+func TestLoadParameterValues( t *testing.T ) {
+	dir := t.TempDir()
+	write := func( name string, data string ) string {
+		filename := filepath.Join( dir, name )
+		if err := ioutil.WriteFile( filename, []byte( data ), 0600 ); err != nil {
+			t.Fatal( err )
+		}
+		return filename
+	}
+	base := write( "base.yaml", "HOST: db.example.com\nREPLICAS: 2\n" )
+	prod := write( "prod.yaml", "REPLICAS: 5\n" )
+	undeclared := write( "undeclared.yaml", "OTHER: x\n" )
+
+	xr := testParameterXR( "HOST", "REPLICAS", "DEBUG", "UNSET" )
+	debug := "false"
+	xr.Spec.Parameters[2].Default = &debug
+
+	values, err := LoadParameterValues( xr, []string{ base, prod } )
+	if err != nil {
+		t.Fatal( err )
+	}
+	expected := map[string]interface{}{ "HOST": "db.example.com", "REPLICAS": 5.0, "DEBUG": "false" }
+	if !reflect.DeepEqual( values, expected ) {
+		t.Errorf( "values = %v, expected %v", values, expected )
+	}
+
+	for _, files := range [][]string{ { undeclared }, { filepath.Join( dir, "missing.yaml" ) } } {
+		if _, err := LoadParameterValues( xr, files ); err == nil {
+			t.Errorf( "LoadParameterValues(%v): expected an error", files )
+		}
+	}
+
+}
@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"os"
+	"fmt"
+	"sort"
+	"strings"
+	"os/exec"
+	"io/ioutil"
+	"path/filepath"
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// A jq program (type jq) or an executable (type exec) applied to the
+// object files selected by Match and, when specified, by label selector,
+// annotation selector and condition. An empty Match selects every object
+// for exec patches, or if another criterion is given.
+type Patch struct {
+	Match string `json:"match"`
+	Selector string `json:"selector"`
+	AnnotationSelector string `json:"annotationSelector"`
+	Condition *PatchCondition `json:"condition"`
+	Patch string `json:"patch"`
+	Type string `json:"type"`
+	Command string `json:"command"`
+	Args []string `json:"args"`
+}
+
+// Satisfied when the JSONPath (e.g. "{.spec.strategy.type}") finds a value
+// or, if Equals is set, when any value found has the string form Equals.
+type PatchCondition struct {
+	JSONPath string `json:"jsonPath"`
+	Equals *string `json:"equals"`
+}
+
+type patchSelector struct {
+	labels labels.Selector
+	annotations labels.Selector
+	condition *jsonpath.JSONPath
+	equals *string
+}
+
+func newPatchSelector( patch *Patch ) (*patchSelector, error) {
+	ps := &patchSelector{}
+	var err error
+
+	if patch.Selector != "" {
+		ps.labels, err = labels.Parse( patch.Selector )
+		if err != nil {
+			return nil, fmt.Errorf( "Invalid patch selector %q: %v", patch.Selector, err )
+		}
+	}
+
+	if patch.AnnotationSelector != "" {
+		ps.annotations, err = labels.Parse( patch.AnnotationSelector )
+		if err != nil {
+			return nil, fmt.Errorf( "Invalid patch annotationSelector %q: %v", patch.AnnotationSelector, err )
+		}
+	}
+
+	if patch.Condition != nil {
+		ps.condition = jsonpath.New( "condition" ).AllowMissingKeys( true )
+		err = ps.condition.Parse( patch.Condition.JSONPath )
+		if err != nil {
+			return nil, fmt.Errorf( "Invalid patch condition %q: %v", patch.Condition.JSONPath, err )
+		}
+		ps.equals = patch.Condition.Equals
+	}
+
+	return ps, nil
+}
+
+func (ps *patchSelector) empty() bool {
+	return ps.labels == nil && ps.annotations == nil && ps.condition == nil
+}
+
+func stringMap( v interface{} ) labels.Set {
+	set := labels.Set{}
+	m, _ := v.(map[string]interface{})
+	for key, value := range m {
+		set[ key ] = fmt.Sprint( value )
+	}
+	return set
+}
+
+func (ps *patchSelector) matches( obj interface{} ) (bool, error) {
+	if ps.labels != nil && ! ps.labels.Matches( stringMap( GetJSONPath( obj, "metadata", "labels" ) ) ) {
+		return false, nil
+	}
+	if ps.annotations != nil && ! ps.annotations.Matches( stringMap( GetJSONPath( obj, "metadata", "annotations" ) ) ) {
+		return false, nil
+	}
+	if ps.condition != nil {
+		results, err := ps.condition.FindResults( obj )
+		if err != nil {
+			return false, err
+		}
+		found := false
+		for _, result := range results {
+			for _, v := range result {
+				if ps.equals == nil || fmt.Sprint( v.Interface() ) == *ps.equals {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// The context passed to exec patches in XRUTIL_* environment variables.
+type PatchContext struct {
+	Phase string // export or import
+	Version string
+	Namespace string // exported from or imported into
+}
+
+// Returns the object files a patch applies to as kind/name => filename.
+func selectPatchFiles( xr *XR, patch *Patch, selector *patchSelector, baseDir string ) (map[string]string, error) {
+	var files map[string]string
+	if patch.Match == "" && ( patch.Type == "exec" || ! selector.empty() ) {
+		files = FindAllKindFiles( xr, baseDir )
+	} else {
+		files = FindKindNameFiles( xr, baseDir, patch.Match )
+	}
+
+	if selector.empty() {
+		return files, nil
+	}
+
+	for fullName, path := range files {
+		data, err := ioutil.ReadFile( path )
+		if err != nil {
+			return nil, fmt.Errorf( "Error reading %v: %v", path, err )
+		}
+		var obj interface{}
+		err = json.Unmarshal( data, &obj )
+		if err != nil {
+			return nil, fmt.Errorf( "Error parsing %v: %v", path, err )
+		}
+		ok, err := selector.matches( obj )
+		if err != nil {
+			return nil, fmt.Errorf( "Error evaluating patch condition on %v: %v", fullName, err )
+		}
+		if !ok {
+			Out.Debug( "Patch [%v] does not select: %v", patchDescription( patch ), fullName )
+			delete( files, fullName )
+		}
+	}
+	return files, nil
+}
+
+func patchDescription( patch *Patch ) string {
+	if patch.Type == "exec" {
+		return strings.TrimSpace( strings.Join( append( []string{ patch.Command }, patch.Args... ), " " ) )
+	}
+	return strings.TrimSpace( patch.Patch )
+}
+
+// Runs an exec patch: the selected objects are written to the command's
+// stdin as a List and the List it writes to stdout replaces them. Objects
+// missing from the result are removed and new objects are added.
+func runExecPatch( xr *XR, patch *Patch, files map[string]string, baseDir string, ctx PatchContext ) error {
+	var names []string
+	for fullName := range files {
+		names = append( names, fullName )
+	}
+	sort.Strings( names )
+
+	items := []interface{}{}
+	for _, fullName := range names {
+		data, err := ioutil.ReadFile( files[ fullName ] )
+		if err != nil {
+			return fmt.Errorf( "Error reading %v: %v", files[ fullName ], err )
+		}
+		var obj interface{}
+		err = json.Unmarshal( data, &obj )
+		if err != nil {
+			return fmt.Errorf( "Error parsing %v: %v", files[ fullName ], err )
+		}
+		items = append( items, obj )
+	}
+
+	input, err := json.Marshal( map[string]interface{}{ "apiVersion": "v1", "kind": "List", "items": items } )
+	if err != nil {
+		return fmt.Errorf( "Error marshalling objects for %v: %v", patch.Command, err )
+	}
+
+	env := []string{
+		"XRUTIL_PHASE=" + ctx.Phase,
+		"XRUTIL_VERSION=" + ctx.Version,
+		"XRUTIL_NAMESPACE=" + ctx.Namespace,
+		"XRUTIL_XR_NAME=" + xr.Metadata.Name,
+	}
+	Out.Info( "Running exec patch [%v] on %v object(s)", patchDescription( patch ), len( items ) )
+	so, se, err := ExecInputEnv( input, env, patch.Command, patch.Args... )
+	if se != "" {
+		for _, line := range strings.Split( se, "\n" ) {
+			if err != nil {
+				Out.Error( "[%v] %v", patch.Command, line )
+			} else {
+				Out.Info( "[%v] %v", patch.Command, line )
+			}
+		}
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return fmt.Errorf( "Exec patch %v exited with status %v", patch.Command, exitErr.ExitCode() )
+	} else if err != nil {
+		return fmt.Errorf( "Unable to run exec patch %v: %v", patch.Command, err )
+	}
+
+	var result struct {
+		Kind string `json:"kind"`
+		Items []map[string]interface{} `json:"items"`
+	}
+	err = json.Unmarshal( so, &result )
+	if err != nil {
+		return fmt.Errorf( "Exec patch %v did not write a List: %v", patch.Command, err )
+	}
+	if result.Kind != "List" {
+		return fmt.Errorf( "Exec patch %v wrote kind %q instead of a List", patch.Command, result.Kind )
+	}
+
+	written := map[string]struct{}{}
+	for _, obj := range result.Items {
+		name, _ := GetJSONPath( obj, "metadata", "name" ).(string)
+		if k, _ := obj[ "kind" ].(string); k == "" || name == "" {
+			return fmt.Errorf( "Exec patch %v returned an object without kind or name", patch.Command )
+		}
+		fullName := ObjectFullName( obj )
+		if _, ok := written[ fullName ]; ok {
+			return fmt.Errorf( "Exec patch %v returned %v more than once", patch.Command, fullName )
+		}
+		written[ fullName ] = struct{}{}
+
+		path, ok := files[ fullName ]
+		if !ok {
+			// Another object file outside the selection would be overwritten
+			if _, exists := FindAllKindFiles( xr, baseDir )[ fullName ]; exists {
+				return fmt.Errorf( "Exec patch %v returned %v, which exists but was not selected", patch.Command, fullName )
+			}
+			kindDir := filepath.Join( baseDir, ObjectKind( obj ) )
+			err = os.MkdirAll( kindDir, 0700 )
+			if err != nil {
+				return fmt.Errorf( "Error creating directory %v: %v", kindDir, err )
+			}
+			path = filepath.Join( kindDir, name + ".json" )
+			Out.Info( "Adding object from exec patch: %v", fullName )
+		}
+
+		data, err := json.MarshalIndent( obj, "", "\t" )
+		if err != nil {
+			return fmt.Errorf( "Error marshalling %v: %v", fullName, err )
+		}
+		err = ioutil.WriteFile( path, data, 0600 )
+		if err != nil {
+			return fmt.Errorf( "Error writing patch result on %v: %v", path, err )
+		}
+	}
+
+	for _, fullName := range names {
+		if _, ok := written[ fullName ]; ok {
+			continue
+		}
+		Out.Info( "Removing object dropped by exec patch: %v", fullName )
+		err = os.Remove( files[ fullName ] )
+		if err != nil {
+			return fmt.Errorf( "Error removing %v: %v", files[ fullName ], err )
+		}
+	}
+	return nil
+}
+
+// Applies patches to the object files in baseDir.
+func RunPatches( xr *XR, patches []Patch, baseDir string, ctx PatchContext ) error {
+	for i := range patches {
+		patch := &patches[i]
+		switch patch.Type {
+		case "jq":
+		case "exec":
+			if patch.Command == "" {
+				return fmt.Errorf( "Exec patch must specify command" )
+			}
+		default:
+			return fmt.Errorf( "Patch type is not supported: %v", patch.Type )
+		}
+
+		selector, err := newPatchSelector( patch )
+		if err != nil {
+			return err
+		}
+
+		files, err := selectPatchFiles( xr, patch, selector, baseDir )
+		if err != nil {
+			return err
+		}
+
+		if patch.Type == "exec" {
+			err = runExecPatch( xr, patch, files, baseDir, ctx )
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		for fullName, fileToPatch := range files {
+			so, se, err := Exec( "jq", patch.Patch, fileToPatch )
+			if err != nil {
+				return fmt.Errorf( "Error running jq patch operation on %v [%v]: %v", fileToPatch, err, se )
+			}
+			Out.Info( "Applying patch [%v]: %v", patch.Patch, fullName)
+			// Overwrite the prior file with the patched version
+			err = ioutil.WriteFile( fileToPatch, []byte(so), 0600 )
+			if err != nil {
+				return fmt.Errorf("Error writing patch result on %v: %v", fileToPatch, err )
+			}
+		}
+	}
+	return nil
+}
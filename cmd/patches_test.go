@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Writes an executable shell script for exec patches and returns its path.
+func writeTestPatchCommand( t *testing.T, script string ) string {
+	path := filepath.Join( t.TempDir(), "patch.sh" )
+	if err := ioutil.WriteFile( path, []byte( "#!/bin/sh\n" + script + "\n" ), 0700 ); err != nil {
+		t.Fatal( err )
+	}
+	return path
+}
+
+// Returns what fn writes to stdout and stderr.
+func captureOutput( t *testing.T, fn func() ) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal( err )
+	}
+	priorOut, priorErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	defer func() { os.Stdout, os.Stderr = priorOut, priorErr }()
+
+	done := make( chan []byte )
+	go func() {
+		data, _ := ioutil.ReadAll( r )
+		done <- data
+	}()
+	fn()
+	w.Close()
+	return string( <-done )
+}
+
+func TestRunExecPatches( t *testing.T ) {
+	useBuiltinKinds( t )
+	xr := &XR{}
+	xr.Spec.Format = "json"
+
+	settings := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings"},"data":{"mode":"a"}}`
+	db := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"db"},"data":{"mode":"a"}}`
+	added := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"added"}}`
+
+	cases := []struct {
+		name string
+		match string
+		script string
+		expected map[string]string // kind/name => object; nil for an error
+		output string
+	}{
+		// The List round trips unchanged through cat
+		{ "round trip", "", `cat`,
+			map[string]string{ "configmaps/settings": settings, "configmaps/db": db }, "" },
+		{ "modify", "configmaps/db", `sed 's/"mode":"a"/"mode":"b"/'`,
+			map[string]string{ "configmaps/settings": settings, "configmaps/db": strings.Replace( db, `"a"`, `"b"`, 1 ) }, "" },
+		{ "add and drop", "configmaps/db", `echo '{"kind":"List","items":[` + added + `]}'`,
+			map[string]string{ "configmaps/settings": settings, "configmaps/added": added }, "" },
+		{ "context", "", `echo "phase=$XRUTIL_PHASE version=$XRUTIL_VERSION" >&2; cat`,
+			map[string]string{ "configmaps/settings": settings, "configmaps/db": db }, "] phase=import version=v2" },
+		{ "exit status", "", `echo "bad input" >&2; exit 3`,
+			nil, "] bad input" },
+		{ "not a list", "", `echo '{"kind":"ConfigMap"}'`,
+			nil, "" },
+		{ "unselected object", "configmaps/db", `echo '{"kind":"List","items":[` + settings + `]}'`,
+			nil, "" },
+	}
+	for _, tc := range cases {
+		dir := t.TempDir()
+		writeTestObject( t, dir, "configmaps/settings.json", settings )
+		writeTestObject( t, dir, "configmaps/db.json", db )
+
+		patches := []Patch{ { Type: "exec", Match: tc.match, Command: writeTestPatchCommand( t, tc.script ) } }
+		var err error
+		output := captureOutput( t, func() {
+			err = RunPatches( xr, patches, dir, PatchContext{ Phase: "import", Version: "v2", Namespace: "demo" } )
+		})
+		if ! strings.Contains( output, tc.output ) {
+			t.Errorf( "%v: output %q does not contain %q", tc.name, output, tc.output )
+		}
+		if tc.expected == nil {
+			if err == nil {
+				t.Errorf( "%v: expected an error", tc.name )
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf( "%v: %v", tc.name, err )
+			continue
+		}
+
+		files := FindAllKindFiles( xr, dir )
+		objects := map[string]interface{}{}
+		for fullName, path := range files {
+			data, err := ioutil.ReadFile( path )
+			if err != nil {
+				t.Fatal( err )
+			}
+			objects[ fullName ] = parseTestObject( t, string( data ) )
+		}
+		expected := map[string]interface{}{}
+		for fullName, obj := range tc.expected {
+			expected[ fullName ] = parseTestObject( t, obj )
+		}
+		if !reflect.DeepEqual( objects, expected ) {
+			t.Errorf( "%v: objects %v, expected %v", tc.name, objects, expected )
+		}
+	}
+}
+
+func TestRunExecPatchExitStatus( t *testing.T ) {
+	useBuiltinKinds( t )
+	xr := &XR{}
+	xr.Spec.Format = "json"
+	dir := t.TempDir()
+	writeTestObject( t, dir, "configmaps/settings.json", `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings"}}` )
+
+	command := writeTestPatchCommand( t, `exit 3` )
+	var err error
+	captureOutput( t, func() {
+		err = RunPatches( xr, []Patch{ { Type: "exec", Command: command } }, dir, PatchContext{} )
+	})
+	if err == nil || ! strings.Contains( err.Error(), "exited with status 3" ) {
+		t.Errorf( "error %v does not report the exit status", err )
+	}
+
+	missing := filepath.Join( dir, "missing" )
+	err = RunPatches( xr, []Patch{ { Type: "exec", Command: missing } }, dir, PatchContext{} )
+	if err == nil || ! strings.Contains( err.Error(), "Unable to run exec patch" ) {
+		t.Errorf( "error %v does not report that the command could not start", err )
+	}
+}
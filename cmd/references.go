@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"strings"
+)
+
+// Describes a field which names another object in the same namespace.
+// Key is the name of the map containing the field as reported by
+// SpiderObject (e.g. "configMapKeyRef" for env[].valueFrom.configMapKeyRef).
+// When Kind is empty, the referenced kind is read from the map's kind and
+// apiVersion (or apiGroup) fields. Within limits a rule to maps inside
+// objects of one kind.
+type referenceRule struct {
+	Within string
+	Key string
+	Field string
+	Kind string
+}
+
+const (
+	kindHPA = "horizontalpodautoscalers.autoscaling"
+	kindRoleBinding = "rolebindings.rbac.authorization.k8s.io"
+	kindIngress = "ingresses.networking.k8s.io"
+)
+
+var referenceRules = []referenceRule{
+	{ Key: "configMapKeyRef", Field: "name", Kind: KIND_CONFIGMAP },
+	{ Key: "configMapRef", Field: "name", Kind: KIND_CONFIGMAP }, // envFrom
+	{ Key: "configMap", Field: "name", Kind: KIND_CONFIGMAP }, // volumes and projected sources
+	{ Key: "secretKeyRef", Field: "name", Kind: KIND_SECRET },
+	{ Key: "secretRef", Field: "name", Kind: KIND_SECRET }, // envFrom
+	{ Key: "secret", Field: "secretName", Kind: KIND_SECRET }, // volumes
+	{ Key: "secret", Field: "name", Kind: KIND_SECRET }, // projected sources and build secrets
+	{ Key: "imagePullSecrets", Field: "name", Kind: KIND_SECRET },
+	{ Key: "pullSecret", Field: "name", Kind: KIND_SECRET }, // build strategies
+	{ Key: "pushSecret", Field: "name", Kind: KIND_SECRET },
+	{ Key: "sourceSecret", Field: "name", Kind: KIND_SECRET },
+	{ Key: "persistentVolumeClaim", Field: "claimName", Kind: KIND_PVC },
+	{ Key: "spec", Field: "serviceAccountName", Kind: KIND_SA },
+	{ Key: "spec", Field: "serviceAccount", Kind: KIND_SA }, // deprecated alias of serviceAccountName
+	{ Within: KIND_STATEFULSET, Key: "spec", Field: "serviceName", Kind: KIND_SERVICE },
+	{ Within: KIND_ROUTE, Key: "to", Field: "name" },
+	{ Within: KIND_ROUTE, Key: "alternateBackends", Field: "name" },
+	{ Within: kindIngress, Key: "service", Field: "name", Kind: KIND_SERVICE },
+	{ Within: kindHPA, Key: "scaleTargetRef", Field: "name" },
+	{ Within: kindRoleBinding, Key: "subjects", Field: "name" },
+	{ Within: kindRoleBinding, Key: "roleRef", Field: "name" },
+	{ Within: KIND_DC, Key: "from", Field: "name" }, // imageChangeParams
+	{ Within: KIND_BC, Key: "from", Field: "name" }, // strategy base images
+	{ Within: KIND_BC, Key: "to", Field: "name" }, // output
+	{ Key: "ownerReferences", Field: "name" },
+}
+
+// Owner references are renamed with their owner but do not make the owner
+// a dependency; export drops references to owners which are not exported.
+const ownerReferenceVia = "ownerReferences.name"
+
+// An object named by a field of another object.
+type ObjectReference struct {
+	FullName string // kind/name of the referenced object
+	Via string // key.field holding the reference
+	Namespace string // namespace accompanying the reference, if any
+
+	m map[string]interface{}
+	field string
+	suffix string // e.g. ":<tag>" for an ImageStreamTag reference
+}
+
+// Returns true if the reference names an object in the namespace: it has
+// no namespace of its own or the same one.
+func (ref *ObjectReference) IsLocal( namespace string ) bool {
+	return ref.Namespace == "" || ref.Namespace == namespace
+}
+
+// Changes the name of the referenced object in the referencing object.
+func (ref *ObjectReference) Rename( name string ) {
+	ref.m[ ref.field ] = name + ref.suffix
+}
+
+// Returns the kind and name of the object referenced by the map. Image
+// stream tags and images are references to their image stream.
+func (rule *referenceRule) resolve( m map[string]interface{} ) (kind string, name string, suffix string) {
+	name, _ = m[ rule.Field ].(string)
+	if name == "" || rule.Kind != "" {
+		return rule.Kind, name, ""
+	}
+
+	k, _ := m[ "kind" ].(string)
+	if k == "" {
+		return "", "", ""
+	}
+	apiVersion, _ := m[ "apiVersion" ].(string)
+	if apiGroup, ok := m[ "apiGroup" ].(string); ok && apiGroup != "" {
+		apiVersion = apiGroup + "/"
+	}
+
+	switch k {
+	case "ImageStreamTag":
+		if i := strings.Index( name, ":" ); i >= 0 {
+			name, suffix = name[:i], name[i:]
+		}
+		return KIND_IS, name, suffix
+	case "ImageStreamImage":
+		if i := strings.Index( name, "@" ); i >= 0 {
+			name, suffix = name[:i], name[i:]
+		}
+		return KIND_IS, name, suffix
+	}
+	return ResourceNameForObject( apiVersion, k ), name, ""
+}
+
+// Calls visit for every reference to another object within an object
+// definition. A namespace field accompanying a reference is reported in
+// Namespace; callers decide whether the referenced object belongs to the
+// repository.
+func VisitReferences( obj interface{}, visit func( ref *ObjectReference ) ) {
+	SpiderObject( obj, func( within string, key string, m map[string]interface{} ) {
+		for i := range referenceRules {
+			rule := &referenceRules[i]
+			if rule.Key != key || ( rule.Within != "" && rule.Within != within ) {
+				continue
+			}
+			kind, name, suffix := rule.resolve( m )
+			if kind == "" || name == "" {
+				continue
+			}
+			namespace, _ := m[ "namespace" ].(string)
+			visit( &ObjectReference{
+				FullName: kind + "/" + name,
+				Via: rule.Key + "." + rule.Field,
+				Namespace: namespace,
+				m: m,
+				field: rule.Field,
+				suffix: suffix,
+			})
+		}
+	})
+}
+
+// Returns the objects in the namespace referenced by an object definition,
+// in no particular order and without duplicates. References to objects in
+// other namespaces and to owners are omitted.
+func FindReferences( obj interface{}, namespace string ) []ObjectReference {
+	var refs []ObjectReference
+	seen := map[string]struct{}{}
+
+	VisitReferences( obj, func( ref *ObjectReference ) {
+		if ! ref.IsLocal( namespace ) || ref.Via == ownerReferenceVia {
+			return
+		}
+		if _, ok := seen[ ref.FullName ]; ok {
+			return
+		}
+		seen[ ref.FullName ] = struct{}{}
+		refs = append( refs, *ref )
+	})
+
+	return refs
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"sort"
+	"reflect"
+	"testing"
+	"encoding/json"
+)
+
+const testBuildConfig = `{
+	"apiVersion": "build.openshift.io/v1",
+	"kind": "BuildConfig",
+	"metadata": { "name": "app", "namespace": "src" },
+	"spec": {
+		"strategy": {
+			"sourceStrategy": {
+				"from": { "kind": "ImageStreamTag", "name": "ruby:2.7", "namespace": "openshift" },
+				"pullSecret": { "name": "pull" }
+			}
+		},
+		"output": {
+			"to": { "kind": "ImageStreamTag", "name": "app:latest", "namespace": "src" }
+		},
+		"triggers": [
+			{ "type": "ImageChange", "imageChange": { "from": { "kind": "ImageStreamTag", "name": "base:1" } } }
+		]
+	}
+}`
+
+func parseTestObject( t *testing.T, data string ) map[string]interface{} {
+	var obj map[string]interface{}
+	if err := json.Unmarshal( []byte( data ), &obj ); err != nil {
+		t.Fatal( err )
+	}
+	return obj
+}
+
+func TestFindReferencesSkipsOtherNamespaces( t *testing.T ) {
+	useBuiltinKinds( t )
+	obj := parseTestObject( t, testBuildConfig )
+
+	var names []string
+	for _, ref := range FindReferences( obj, "src" ) {
+		names = append( names, ref.FullName )
+	}
+	sort.Strings( names )
+
+	expected := []string{ KIND_IS + "/app", KIND_IS + "/base", KIND_SECRET + "/pull" }
+	if !reflect.DeepEqual( names, expected ) {
+		t.Errorf( "FindReferences = %v, expected %v", names, expected )
+	}
+}
+
+func TestVisitReferencesNamespace( t *testing.T ) {
+	useBuiltinKinds( t )
+	obj := parseTestObject( t, testBuildConfig )
+
+	renames := map[string]string{ KIND_IS + "/ruby": "x-ruby", KIND_IS + "/app": "x-app" }
+	VisitReferences( obj, func( ref *ObjectReference ) {
+		if newName, ok := renames[ ref.FullName ]; ok && ref.IsLocal( "src" ) {
+			ref.Rename( newName )
+		}
+	})
+
+	if v := GetJSONPath( obj, "spec", "strategy", "sourceStrategy", "from", "name" ); v != "ruby:2.7" {
+		t.Errorf( "reference into the openshift namespace was renamed: %v", v )
+	}
+	if v := GetJSONPath( obj, "spec", "output", "to", "name" ); v != "x-app:latest" {
+		t.Errorf( "reference within the namespace was not renamed: %v", v )
+	}
+}
+
+func TestVisitReferencesOwnerReferences( t *testing.T ) {
+	useBuiltinKinds( t )
+	obj := parseTestObject( t, `{
+		"apiVersion": "v1",
+		"kind": "ConfigMap",
+		"metadata": {
+			"name": "settings",
+			"ownerReferences": [ { "apiVersion": "apps/v1", "kind": "Deployment", "name": "web" } ]
+		}
+	}` )
+
+	var names []string
+	VisitReferences( obj, func( ref *ObjectReference ) {
+		names = append( names, ref.FullName )
+		if ref.FullName == KIND_DEPLOYMENT + "/web" {
+			ref.Rename( "x-web" )
+		}
+	})
+	if !reflect.DeepEqual( names, []string{ KIND_DEPLOYMENT + "/web" } ) {
+		t.Errorf( "references = %v", names )
+	}
+	if v := GetJSONPath( obj, "metadata", "ownerReferences" ).([]interface{})[0].(map[string]interface{})[ "name" ]; v != "x-web" {
+		t.Errorf( "owner reference was not renamed: %v", v )
+	}
+
+	// Owners are not dependencies
+	if refs := FindReferences( obj, "" ); len( refs ) != 0 {
+		t.Errorf( "FindReferences = %v, expected none", refs )
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Renames imported objects selected by Match. Name replaces the object's
+// name outright; otherwise NamePrefix and NameSuffix are added to it. The
+// first matching rule applies.
+type RenameRule struct {
+	Match string `json:"match"`
+	Name string `json:"name"`
+	NamePrefix string `json:"namePrefix"`
+	NameSuffix string `json:"nameSuffix"`
+}
+
+// Computes the new name of every object in the repository which is renamed
+// on import, keyed by kind/name. Objects not matched by a rule receive the
+// default prefix and suffix.
+func BuildRenames( rules []RenameRule, fullNames []string, defaultPrefix string, defaultSuffix string ) (map[string]string, error) {
+	renames := map[string]string{}
+	byNewName := map[string]string{}
+
+	for _, fullName := range fullNames {
+		components := strings.SplitN( fullName, "/", 2 )
+		kind, name := components[0], components[1]
+
+		newName := defaultPrefix + name + defaultSuffix
+		for _, rule := range rules {
+			if ! IsMatchedByKindNameList( fullName, rule.Match ) {
+				continue
+			}
+			if rule.Name != "" {
+				newName = rule.Name
+			} else {
+				newName = rule.NamePrefix + name + rule.NameSuffix
+			}
+			break
+		}
+
+		newFullName := kind + "/" + newName
+		if other, ok := byNewName[ newFullName ]; ok {
+			return nil, fmt.Errorf( "Both %v and %v would be renamed to %v", other, fullName, newFullName )
+		}
+		byNewName[ newFullName ] = fullName
+
+		if newName != name {
+			renames[ fullName ] = newName
+		}
+	}
+
+	return renames, nil
+}
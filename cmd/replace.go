@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"encoding/json"
 	"strings"
+	"sort"
+	"fmt"
 )
 
 // replaceCmd represents the replace command
@@ -13,6 +15,7 @@ var replaceCmd = &cobra.Command{
 	Use:   "replace <object-repository-json-file>",
 	Short: "Imports a set of object definitions into OpenShift",
 	Run: func(cmd *cobra.Command, args []string) {
+		_replaceConfig.cluster = clusterOptionsFromFlags()
 		runReplace(&_replaceConfig, cmd, args )
 	},
 }
@@ -22,8 +25,20 @@ type ReplaceConfig struct {
 	version string
 	targetNamespace string
 	namePrefix string
+	nameSuffix string
 	labels string
+	values []string
+	decryptionKey string
+	routeDomain string
+	force bool
 	clean bool
+	cluster ClusterOptions
+	dryRun bool
+	generatedTag string
+
+	// When set, objects are read from this directory instead of the
+	// ObjectRepository (e.g. the staged result of a dry run export).
+	objectDir string
 }
 
 var _replaceConfig ReplaceConfig
@@ -42,24 +57,13 @@ func runReplace(config *ReplaceConfig, cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	projectName, err := OC.Project()
-	if err != nil {
-		Out.Error( "Unable to find current project name: %v", err )
-		os.Exit(1)
-	}
-
-	git, err := PrepGitDir( xr )
-
+	OC, err = ConnectCluster( config.cluster )
 	if err != nil {
-		Out.Error( "Error initializing git repository: %v", err )
+		Out.Error( "Unable to connect to cluster: %v", err )
 		os.Exit(1)
 	}
 
-	if persist,_ := RootCmd.PersistentFlags().GetBool("preserve-git"); persist {
-		Out.Warn( "The working git directory will not be removed: %v", git.repoDir )
-	} else {
-		defer os.RemoveAll( git.repoDir )
-	}
+	projectName := OC.Namespace()
 
 	if config.version == "" {
 		config.version = xr.Spec.DefaultVersion
@@ -68,13 +72,30 @@ func runReplace(config *ReplaceConfig, cmd *cobra.Command, args []string) {
 		}
 	}
 
-	branchName := xr.Spec.Git.Branch.Prefix + config.version
+	objectDir := config.objectDir
+	if objectDir == "" {
+		preserve,_ := RootCmd.PersistentFlags().GetBool("preserve-git")
 
-	_,se,err := git.Exec( "checkout", branchName )
+		store, err := OpenObjectStore( xr, StoreOptions{ Preserve: preserve } )
 
-	if err != nil {
-		Out.Error( "Error checking out git branch (%v) [%v]: %v", branchName, err, se )
-		os.Exit(1)
+		if err != nil {
+			Out.Error( "Error initializing object storage: %v", err )
+			os.Exit(1)
+		}
+		defer store.Close()
+
+		err = store.Fetch( config.version )
+
+		if err != nil {
+			Out.Error( "Error reading version %v: %v", config.version, err )
+			os.Exit(1)
+		}
+		objectDir = store.ObjectDir()
+	}
+
+	// --namespace takes precedence over the XR, but not over --target-namespace
+	if config.targetNamespace == "" {
+		config.targetNamespace = config.cluster.Namespace
 	}
 
 	if config.targetNamespace == "" {
@@ -84,11 +105,14 @@ func runReplace(config *ReplaceConfig, cmd *cobra.Command, args []string) {
 		}
 	}
 
-	setNS := "--namespace=" + config.targetNamespace
-
 	// Delete any object that was created by the XR previously if --clean was specified
-	if config.clean {
-		OC.Exec( "delete", "all", setNS,  "-l", LABEL_REPOSITORY + "=" + xr.Metadata.Name )
+	if config.clean && config.dryRun {
+		Out.Info( "Dry run; not removing prior objects labeled %v=%v", LABEL_REPOSITORY, xr.Metadata.Name )
+	} else if config.clean {
+		err = OC.DeleteLabeled( config.targetNamespace, "all", LABEL_REPOSITORY + "=" + xr.Metadata.Name )
+		if err != nil {
+			Out.Warn( "Unable to clean prior objects: %v", err )
+		}
 	}
 
 	namePrefix := xr.Spec.ImportRules.Transforms.NamePrefix.NamePrefixDefault
@@ -96,15 +120,31 @@ func runReplace(config *ReplaceConfig, cmd *cobra.Command, args []string) {
 		namePrefix = config.namePrefix
 	}
 
-	err = RunPatches( xr, git.objectDir )
+	nameSuffix := xr.Spec.ImportRules.Transforms.NameSuffix.NameSuffixDefault
+	if config.nameSuffix != "" {
+		nameSuffix = config.nameSuffix
+	}
+
+	err = RunPatches( xr, xr.Spec.ExportRules.Transforms.Patches, objectDir, PatchContext{ Phase: "import", Version: config.version, Namespace: config.targetNamespace } )
 	if err != nil {
 		Out.Error( "Error executing import patches: %v", err )
 		os.Exit(1)
 	}
 
 
-	filesToImport := FindAllKindFiles( xr, git.objectDir )
+	filesToImport := FindAllKindFiles( xr, objectDir )
+
+	var fullNames []string
+	for fullName := range filesToImport {
+		fullNames = append( fullNames, fullName )
+	}
+	renames, err := BuildRenames( xr.Spec.ImportRules.Transforms.Renames, fullNames, namePrefix, nameSuffix )
+	if err != nil {
+		Out.Error( "Invalid renames: %v", err )
+		os.Exit(1)
+	}
 
+	selectedFiles := make( map[string]string )
 	for fullName, filename := range filesToImport {
 
 		if xr.Spec.ImportRules.Include != "" {
@@ -119,6 +159,54 @@ func runReplace(config *ReplaceConfig, cmd *cobra.Command, args []string) {
 			continue
 		}
 
+		selectedFiles[ fullName ] = filename
+	}
+
+	metadataTransform, err := NewMetadataTransform( xr, MetadataContext{
+		Version: config.version,
+		Name: xr.Metadata.Name,
+		Namespace: config.targetNamespace,
+	})
+	if err != nil {
+		Out.Error( "%v", err )
+		os.Exit(1)
+	}
+
+	decryptor, err := NewSecretDecryptor( config.decryptionKey )
+	if err != nil {
+		Out.Error( "%v", err )
+		os.Exit(1)
+	}
+	if decryptor != nil {
+		defer decryptor.Close()
+	}
+
+	// Fill in parameters, apply overrides and check that secrets can be
+	// decrypted before replacing anything so that the namespace is not
+	// partially replaced.
+	err = prepareObjectFiles( xr, config, selectedFiles, renames, decryptor )
+	if err != nil {
+		Out.Error( "%v", err )
+		os.Exit(1)
+	}
+
+	err = metadataTransform.Validate( selectedFiles )
+	if err != nil {
+		Out.Error( "%v", err )
+		os.Exit(1)
+	}
+
+	// Reads the prepared routes to check TLS material against their termination
+	routeTransforms, err := NewRouteTransforms( xr, config.targetNamespace, config.version, config.routeDomain, selectedFiles, renames, decryptor )
+	if err != nil {
+		Out.Error( "%v", err )
+		os.Exit(1)
+	}
+
+	var owned []map[string]interface{} // replaced once their owners exist
+
+	for fullName, filename := range selectedFiles {
+
 		jsonString, err := ioutil.ReadFile( filename )
 
 		if err != nil {
@@ -133,7 +221,11 @@ func runReplace(config *ReplaceConfig, cmd *cobra.Command, args []string) {
 			os.Exit(1)
 		}
 
-		if namePrefix != "" {
+		if len( renames ) > 0 {
+			// References into other namespaces (e.g. openshift imagestreams)
+			// name objects outside the repository. Read before the spider
+			// below removes the exported namespace.
+			sourceNamespace, _ := GetJSONPath( obj, "metadata", "namespace" ).(string)
 
 			SpiderObject( obj, func( kind string, key string, m map[string]interface{} ) {
 
@@ -147,62 +239,51 @@ func runReplace(config *ReplaceConfig, cmd *cobra.Command, args []string) {
 					}
 				}
 				if key == "labels" || key == "selector" {
+					// Compare against the exported values when both a prefix and suffix apply
+					original := map[string]interface{}{}
+					for kt, v := range m {
+						original[ kt ] = v
+					}
 					for kt,vt := range xr.Spec.ImportRules.Transforms.NamePrefix.Labels {
-						v,ok := m[ kt ]
-						if ok {
-							vs := v.(string)
-							if vt == "" || vs == vt {
-								m[ kt ] = namePrefix + vs
-							}
+						if vs, ok := original[ kt ].(string); ok && ( vt == "" || vs == vt ) {
+							m[ kt ] = namePrefix + m[ kt ].(string)
 						}
 					}
-					v, ok := m[ "deploymentconfig" ]
-					if ok {
-						// v is the name of a deployment config. See if we are replacing it.
-						vs := v.(string)
-						_, ok := filesToImport[ KIND_DC + "/" + vs ]
-						if ok {
-							m[ "deploymentconfig" ] = namePrefix + vs
+					for kt,vt := range xr.Spec.ImportRules.Transforms.NameSuffix.Labels {
+						if vs, ok := original[ kt ].(string); ok && ( vt == "" || vs == vt ) {
+							m[ kt ] = m[ kt ].(string) + nameSuffix
 						}
 					}
-				}
-				if key == "configMapKeyRef" {
-					v, ok := m[ "name"]
+					v, ok := m[ "deploymentconfig" ]
 					if ok {
+						// v is the name of a deployment config. See if we are renaming it.
 						vs := v.(string)
-						_, ok := filesToImport[ KIND_CONFIGMAP + "/" + vs ]
-						if ok {
-							m[ "name" ] = namePrefix + vs
+						if newName, ok := renames[ KIND_DC + "/" + vs ]; ok {
+							m[ "deploymentconfig" ] = newName
 						}
 					}
 				}
-				if key == "configMap" {
-					v, ok := m[ "name"]
-					if ok {
-						vs := v.(string)
-						_, ok := filesToImport[ KIND_CONFIGMAP + "/" + vs ]
-						if ok {
-							m[ "name" ] = namePrefix + vs
-						}
-					}
+			})
+
+			VisitReferences( obj, func( ref *ObjectReference ) {
+				if ! ref.IsLocal( sourceNamespace ) {
+					Out.Debug( "Not rewriting reference to %v in namespace %v in %v", ref.FullName, ref.Namespace, fullName )
+					return
 				}
-				if key == "secret" {
-					v, ok := m[ "secretName"]
-					if ok {
-						vs := v.(string)
-						_, ok := filesToImport[ KIND_SECRET + "/" + vs ]
-						if ok {
-							m[ "secretName" ] = namePrefix + vs
-						}
-					}
+				if newName, ok := renames[ ref.FullName ]; ok {
+					Out.Debug( "Rewriting reference to %v in %v via %v", ref.FullName, fullName, ref.Via )
+					ref.Rename( newName )
 				}
 			})
 
-			newName := namePrefix + GetJSONPath( obj, "metadata", "name" ).(string)
-			SetJSONPath( obj, []string{ "metadata", "name" }, newName )
-			// TODO: need to check for any references to objects which need to change
+			if newName, ok := renames[ fullName ]; ok {
+				Out.Info( "Renaming %v to %v", fullName, newName )
+				SetJSONPath( obj, []string{ "metadata", "name" }, newName )
+			}
 		}
 
+		metadataTransform.Apply( fullName, obj.(map[string]interface{}) )
+
 		SetLabel( obj, LABEL_REPOSITORY, xr.Metadata.Name )
 		SetLabel( obj, LABEL_REPOSITORY_VERSION, config.version )
 
@@ -218,7 +299,7 @@ func runReplace(config *ReplaceConfig, cmd *cobra.Command, args []string) {
 			}
 		}
 
-		kind := GetJSONPath( obj, "kind" ).(string)
+		kind := ObjectKind( obj )
 		name := GetJSONPath( obj, "metadata", "name" ).(string)
 
 		// Rewrite image references
@@ -232,14 +313,14 @@ func runReplace(config *ReplaceConfig, cmd *cobra.Command, args []string) {
 						registryHost, namespace, repository, tag, err := ParseDockerImageRef( image )
 
 						if err != nil {
-							Out.Error( "Invalid docker image reference in %v: %v", fullName, image )
+							Out.Error( "Invalid docker image reference in %v: %v", fullName, err )
 							os.Exit(1)
 						}
 
 						for _,mapping := range xr.Spec.ImportRules.Transforms.ImageMappings {
 							ok, err := dockerPatternMatches( image, mapping.Pattern, "172.", projectName )
 							if err != nil {
-								Out.Error( "Invalid docker image mapping pattern: %v", mapping.Pattern )
+								Out.Error( "Invalid docker image mapping: %v", err )
 								os.Exit(1)
 							}
 
@@ -248,7 +329,12 @@ func runReplace(config *ReplaceConfig, cmd *cobra.Command, args []string) {
 								newRef += mapDockerComponentWithSuffix(registryHost, mapping.SetRegistryHost, "/" )
 								newRef += mapDockerComponentWithSuffix(namespace, mapping.SetNamespace, "/" )
 								newRef += mapDockerComponent(repository, mapping.SetRepository )
-								newRef += mapDockerTagComponentWithPrefix(tag, mapping.SetTag )
+								if mapping.TagType == "generated" && config.generatedTag != "" {
+									// sync passes the tag of the export it just ran
+									newRef += mapDockerTagComponentWithPrefix(tag, &config.generatedTag )
+								} else {
+									newRef += mapDockerTagComponentWithPrefix(tag, mapping.SetTag )
+								}
 								Out.Info( "Mapping image reference in %v: %q -> %q", fullName, image, newRef )
 								SetJSONObj( entry, "image", newRef )
 								break // Only perform one mapping. The first one that matches.
@@ -260,6 +346,14 @@ func runReplace(config *ReplaceConfig, cmd *cobra.Command, args []string) {
 			}
 		}
 
+		ApplyStorageTransforms( xr, fullName, kind, obj.(map[string]interface{}) )
+
+		err = routeTransforms.ApplyHost( fullName, name, obj.(map[string]interface{}) )
+		if err != nil {
+			Out.Error( "%v", err )
+			os.Exit(1)
+		}
+
 		objData, err := json.MarshalIndent( obj, "", "\t" )
 		if err != nil {
 			Out.Error( "Error marshalling object data (%v): %v", err, obj )
@@ -272,25 +366,211 @@ func runReplace(config *ReplaceConfig, cmd *cobra.Command, args []string) {
 			os.Exit(1)
 		}
 
+		// Applied after the file is written so that TLS keys are not stored
+		routeTransforms.ApplyTLS( fullName, obj.(map[string]interface{}) )
+
+		if kind == KIND_PVC && ! config.force {
+			bound, err := IsBoundClaim( config.targetNamespace, name )
+			if err != nil {
+				Out.Error( "%v", err )
+				os.Exit(1)
+			}
+			if bound {
+				Out.Info( "Not replacing bound persistent volume claim %v; specify --force to replace it and release its volume", name )
+				continue
+			}
+		}
+
 		Out.Info( "Replacing %v with source file: %v", name, fullName )
-		_,se,err = OC.Exec( "replace", setNS, "--cascade=true", "--force", "-f", filename )
+		if config.dryRun {
+			Out.Info( "Dry run; not replacing %v in namespace %v", fullName, config.targetNamespace )
+			continue
+		}
+
+		if IsRedactedSecret( obj.(map[string]interface{}) ) {
+			Out.Info( "Keeping live values of redacted secret: %v", fullName )
+			err = RestoreRedactedSecret( config.targetNamespace, obj.(map[string]interface{}) )
+			if err != nil {
+				Out.Error( "Unable to restore redacted secret %v: %v", fullName, err )
+				os.Exit(1)
+			}
+		}
+
+		if decryptor != nil {
+			_, err = decryptor.DecryptObject( obj.(map[string]interface{}) )
+			if err != nil {
+				Out.Error( "Unable to decrypt %v: %v", fullName, err )
+				os.Exit(1)
+			}
+		}
+
+		// The uid of an owner is only known once the owner is replaced
+		if len( UnresolvedOwners( obj.(map[string]interface{}) ) ) > 0 {
+			owned = append( owned, obj.(map[string]interface{}) )
+			continue
+		}
+
+		err = OC.Replace( config.targetNamespace, obj.(map[string]interface{}) )
 
 		if err != nil {
-			Out.Error( "Error while replacing object definition (%v) [%v]: %v", fullName, err, se )
+			Out.Error( "Error while replacing object definition (%v): %v", fullName, err )
 			os.Exit(1)
 		}
 	}
 
+	err = replaceOwned( config.targetNamespace, owned )
+	if err != nil {
+		Out.Error( "%v", err )
+		os.Exit(1)
+	}
+
 	Out.Info( "Operation complete.")
 }
 
+// Replaces objects whose owner references need the uid of an owner in the
+// namespace. Objects are replaced after any owners which are also pending.
+func replaceOwned( namespace string, owned []map[string]interface{} ) error {
+	for len( owned ) > 0 {
+		pending := map[string]struct{}{}
+		for _, obj := range owned {
+			pending[ ObjectFullName( obj ) ] = struct{}{}
+		}
+
+		var ready, waiting []map[string]interface{}
+		for _, obj := range owned {
+			blocked := false
+			for _, owner := range UnresolvedOwners( obj ) {
+				if _, ok := pending[ owner ]; ok && owner != ObjectFullName( obj ) {
+					blocked = true
+				}
+			}
+			if blocked {
+				waiting = append( waiting, obj )
+			} else {
+				ready = append( ready, obj )
+			}
+		}
+		if len( ready ) == 0 {
+			// Owners reference each other; resolve against what exists
+			ready, waiting = waiting, nil
+		}
+
+		for _, obj := range ready {
+			fullName := ObjectFullName( obj )
+			err := ResolveOwnerReferences( namespace, fullName, obj )
+			if err != nil {
+				return err
+			}
+			err = OC.Replace( namespace, obj )
+			if err != nil {
+				return fmt.Errorf( "Error while replacing object definition (%v): %v", fullName, err )
+			}
+		}
+		owned = waiting
+	}
+	return nil
+}
+
+// Substitutes parameter values and applies workload overrides to the
+// object files, and verifies that encrypted secrets can be decrypted and
+// redacted secrets exist in the target namespace. Secrets are left
+// encrypted on disk.
+func prepareObjectFiles( xr *XR, config *ReplaceConfig, files map[string]string, renames map[string]string, decryptor *SecretDecryptor ) error {
+	values, err := LoadParameterValues( xr, config.values )
+	if err != nil {
+		return err
+	}
+
+	overrides := xr.Spec.ImportRules.Transforms.Workloads
+	err = ValidateWorkloadOverrides( overrides )
+	if err != nil {
+		return err
+	}
+	matched := make( []int, len( overrides ) )
+
+	var missing []string
+	for fullName, filename := range files {
+		data, err := ioutil.ReadFile( filename )
+		if err != nil {
+			return fmt.Errorf( "Error reading imported file (%v) [%v]", filename, err )
+		}
+
+		var obj interface{}
+		err = json.Unmarshal( data, &obj )
+		if err != nil {
+			return fmt.Errorf( "Error parsing imported file (%v) [%v]", filename, err )
+		}
+
+		obj, unset := SubstituteParameters( xr, obj, values )
+		for _, name := range unset {
+			missing = append( missing, fmt.Sprintf( "%v (used by %v)", name, fullName ) )
+		}
+
+		if m, ok := obj.(map[string]interface{}); ok {
+			err = ApplyWorkloadOverrides( overrides, fullName, m, matched )
+			if err != nil {
+				return err
+			}
+		}
+
+		data, err = json.MarshalIndent( obj, "", "\t" )
+		if err != nil {
+			return fmt.Errorf( "Error marshalling object data (%v): %v", fullName, err )
+		}
+		err = ioutil.WriteFile( filename, data, 0600 )
+		if err != nil {
+			return fmt.Errorf( "Error writing object data to file (%v) [%v]", filename, err )
+		}
+
+		if m, ok := obj.(map[string]interface{}); ok && HasEncryptedValues( m ) {
+			if decryptor == nil {
+				return fmt.Errorf( "%v contains encrypted values; specify --decryption-key or set %v", fullName, ENV_DECRYPTION_KEY )
+			}
+			_, err = decryptor.DecryptObject( m )
+			if err != nil {
+				return fmt.Errorf( "Unable to decrypt %v: %v", fullName, err )
+			}
+		}
+
+		if m, ok := obj.(map[string]interface{}); ok && IsRedactedSecret( m ) {
+			name := strings.SplitN( fullName, "/", 2 )[1]
+			if newName, ok := renames[ fullName ]; ok {
+				name = newName
+			}
+			err = CheckRedactedSecret( config.targetNamespace, name )
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, count := range matched {
+		if count == 0 {
+			return fmt.Errorf( "Workload override %v does not match any imported workload", overrides[i].Match )
+		}
+	}
+
+	if len( missing ) > 0 {
+		sort.Strings( missing )
+		return fmt.Errorf( "No value for parameters: %v", strings.Join( missing, ", " ) )
+	}
+	return nil
+}
+
 func init() {
 	RootCmd.AddCommand(replaceCmd)
 	replaceCmd.Flags().StringVar(&_replaceConfig.xrFile, "config", "", "Path to ObjectRepository JSON file")
 	replaceCmd.Flags().StringVar(&_replaceConfig.version, "from", "", "Version to import")
 	replaceCmd.Flags().StringVar(&_replaceConfig.targetNamespace, "target-namespace", "", "Target namespace if not current")
 	replaceCmd.Flags().StringVar(&_replaceConfig.namePrefix, "name-prefix", "", "Name prefix for objects being created")
+	replaceCmd.Flags().StringVar(&_replaceConfig.nameSuffix, "name-suffix", "", "Name suffix for objects being created")
 	replaceCmd.Flags().StringVar(&_replaceConfig.labels, "labels", "", "New labels for objects being created")
+	replaceCmd.Flags().StringArrayVar(&_replaceConfig.values, "values", nil, "YAML file of parameter values; may be repeated with later files taking precedence")
+	replaceCmd.Flags().StringVar(&_replaceConfig.decryptionKey, "decryption-key", "", "Private key file (age identity or OpenPGP key) for encrypted secrets (default $" + ENV_DECRYPTION_KEY + ")")
+	replaceCmd.Flags().StringVar(&_replaceConfig.routeDomain, "route-domain", "", "Cluster domain for route host templates which do not specify a domain")
+	replaceCmd.Flags().BoolVar(&_replaceConfig.force, "force", false, "Replace persistent volume claims which are bound in the target namespace; this may destroy their data")
 	replaceCmd.Flags().BoolVar(&_replaceConfig.clean, "clean", false, "Removes any prior resources by the config")
+	replaceCmd.Flags().BoolVar(&_replaceConfig.dryRun, "dry-run", false, "Report the objects which would be replaced without changing the cluster")
+	replaceCmd.Flags().StringVar(&_replaceConfig.generatedTag, "generated-tag", "", "Image tag produced by export for imageMappings with tagType generated; the stored tag is kept when unset")
 
 }
@@ -24,7 +24,19 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 	RootCmd.PersistentFlags().BoolVarP( &debug, "verbose", "v", false, "Output debug level messaging")
-	RootCmd.PersistentFlags().Bool( "preserve-git", false, "Specify to prevent git repository directory cleanup")
+	RootCmd.PersistentFlags().String( "kubeconfig", "", "Path to the kubeconfig file to use instead of the default")
+	RootCmd.PersistentFlags().String( "context", "", "Name of the kubeconfig context to use instead of the current context")
+	RootCmd.PersistentFlags().StringP( "namespace", "n", "", "Namespace to use instead of the context's namespace")
+	RootCmd.PersistentFlags().Bool( "preserve-git", false, "Specify to prevent cleanup of the working git repository or object directory")
+}
+
+// Returns the cluster connection settings specified by persistent flags.
+func clusterOptionsFromFlags() ClusterOptions {
+	var opts ClusterOptions
+	opts.Kubeconfig,_ = RootCmd.PersistentFlags().GetString("kubeconfig")
+	opts.Context,_ = RootCmd.PersistentFlags().GetString("context")
+	opts.Namespace,_ = RootCmd.PersistentFlags().GetString("namespace")
+	return opts
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"fmt"
+	"bytes"
+	"strings"
+	"io/ioutil"
+	"encoding/json"
+	"text/template"
+	"encoding/base64"
+)
+
+// Rewrites the host and TLS material of imported routes selected by Match
+// (every route when empty). Host is a template which may reference
+// {{.Name}} (the route's imported name), {{.Namespace}}, {{.Domain}} and
+// {{.Version}}. ClearHost removes the host so the router generates one.
+type RouteTransform struct {
+	Match string `json:"match"`
+	Host string `json:"host"`
+	ClearHost bool `json:"clearHost"`
+	Domain string `json:"domain"`
+	TLS *RouteTLS `json:"tls"`
+}
+
+// TLS material for routes. DestinationCACertificateFile is only valid for
+// reencrypt termination.
+type RouteTLS struct {
+	// A kubernetes.io/tls secret in the target namespace supplying
+	// tls.crt, tls.key and, if present, ca.crt
+	Secret string `json:"secret"`
+	CertificateFile string `json:"certificateFile"`
+	KeyFile string `json:"keyFile"`
+	CACertificateFile string `json:"caCertificateFile"`
+	DestinationCACertificateFile string `json:"destinationCACertificateFile"`
+}
+
+// The values available to RouteTransform host templates.
+type RouteHostContext struct {
+	Name string
+	Namespace string
+	Domain string
+	Version string
+}
+
+type preparedRouteTransform struct {
+	match string
+	host *template.Template
+	clearHost bool
+	domain string
+	tls map[string]string // spec.tls field => PEM
+}
+
+type RouteTransforms struct {
+	rules []preparedRouteTransform
+	namespace string
+	version string
+}
+
+// Parses host templates and loads TLS material so that problems are
+// reported before any object is replaced. defaultDomain applies to rules
+// which do not specify a domain. files holds the object files to be
+// imported; a destination CA certificate may only be supplied for the
+// reencrypt routes among them. A TLS secret imported with the routes is
+// read from files (renames maps full names to imported names) rather than
+// from the namespace.
+func NewRouteTransforms( xr *XR, namespace string, version string, defaultDomain string, files map[string]string, renames map[string]string, decryptor *SecretDecryptor ) (*RouteTransforms, error) {
+	rt := &RouteTransforms{ namespace: namespace, version: version }
+
+	for _, rule := range xr.Spec.ImportRules.Transforms.Routes {
+		p := preparedRouteTransform{ match: rule.Match, clearHost: rule.ClearHost, domain: rule.Domain }
+		if p.domain == "" {
+			p.domain = defaultDomain
+		}
+
+		if rule.Host != "" && rule.ClearHost {
+			return nil, fmt.Errorf( "Route transform %q specifies both host and clearHost", rule.Match )
+		}
+
+		if rule.Host != "" {
+			t, err := template.New( "host" ).Option( "missingkey=error" ).Parse( rule.Host )
+			if err != nil {
+				return nil, fmt.Errorf( "Invalid route host template %q: %v", rule.Host, err )
+			}
+			if strings.Contains( rule.Host, ".Domain" ) && p.domain == "" {
+				return nil, fmt.Errorf( "Route host template %q uses .Domain but no domain was specified", rule.Host )
+			}
+			err = t.Execute( ioutil.Discard, RouteHostContext{} )
+			if err != nil {
+				return nil, fmt.Errorf( "Invalid route host template %q: %v", rule.Host, err )
+			}
+			p.host = t
+		}
+
+		if rule.TLS != nil {
+			p.tls = map[string]string{}
+
+			if rule.TLS.Secret != "" {
+				secret, err := routeTLSSecret( namespace, rule.TLS.Secret, files, renames, decryptor )
+				if err != nil {
+					return nil, fmt.Errorf( "Unable to read route TLS secret %v: %v", rule.TLS.Secret, err )
+				}
+				data, _ := secret["data"].(map[string]interface{})
+				for key, field := range map[string]string{ "tls.crt": "certificate", "tls.key": "key", "ca.crt": "caCertificate" } {
+					encoded, ok := data[ key ].(string)
+					if !ok {
+						continue
+					}
+					decoded, err := base64.StdEncoding.DecodeString( encoded )
+					if err != nil {
+						return nil, fmt.Errorf( "Invalid %v in route TLS secret %v: %v", key, rule.TLS.Secret, err )
+					}
+					p.tls[ field ] = string( decoded )
+				}
+				if p.tls["certificate"] == "" || p.tls["key"] == "" {
+					return nil, fmt.Errorf( "Route TLS secret %v must contain tls.crt and tls.key", rule.TLS.Secret )
+				}
+			}
+
+			for field, file := range map[string]string{
+				"certificate": rule.TLS.CertificateFile,
+				"key": rule.TLS.KeyFile,
+				"caCertificate": rule.TLS.CACertificateFile,
+				"destinationCACertificate": rule.TLS.DestinationCACertificateFile,
+			} {
+				if file == "" {
+					continue
+				}
+				pem, err := ioutil.ReadFile( file )
+				if err != nil {
+					return nil, fmt.Errorf( "Unable to read route TLS file (%v): %v", file, err )
+				}
+				p.tls[ field ] = string( pem )
+			}
+		}
+
+		rt.rules = append( rt.rules, p )
+	}
+
+	for fullName, filename := range files {
+		rule := rt.rule( fullName )
+		if rule == nil || rule.tls[ "destinationCACertificate" ] == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile( filename )
+		if err != nil {
+			return nil, fmt.Errorf( "Error reading %v: %v", filename, err )
+		}
+		var obj interface{}
+		err = json.Unmarshal( data, &obj )
+		if err != nil {
+			return nil, fmt.Errorf( "Error parsing %v: %v", filename, err )
+		}
+		termination, _ := GetJSONPath( obj, "spec", "tls", "termination" ).(string)
+		if termination != "reencrypt" {
+			return nil, fmt.Errorf( "Route transform %q supplies a destination CA certificate but %v does not use reencrypt termination", rule.match, fullName )
+		}
+	}
+
+	return rt, nil
+}
+
+// Returns the secret with the given imported name from the object files,
+// decrypting its values. Falls back to the live secret in the namespace
+// when the secret is not imported or was exported redacted.
+func routeTLSSecret( namespace string, name string, files map[string]string, renames map[string]string, decryptor *SecretDecryptor ) (map[string]interface{}, error) {
+	for fullName, filename := range files {
+		parts := strings.SplitN( fullName, "/", 2 )
+		if len( parts ) != 2 || parts[0] != KIND_SECRET {
+			continue
+		}
+		importedName := parts[1]
+		if newName, ok := renames[ fullName ]; ok {
+			importedName = newName
+		}
+		if importedName != name {
+			continue
+		}
+
+		data, err := ioutil.ReadFile( filename )
+		if err != nil {
+			return nil, fmt.Errorf( "Error reading %v: %v", filename, err )
+		}
+		var secret map[string]interface{}
+		err = json.Unmarshal( data, &secret )
+		if err != nil {
+			return nil, fmt.Errorf( "Error parsing %v: %v", filename, err )
+		}
+		if IsRedactedSecret( secret ) {
+			break
+		}
+		if HasEncryptedValues( secret ) {
+			if decryptor == nil {
+				return nil, fmt.Errorf( "%v contains encrypted values; specify --decryption-key or set %v", fullName, ENV_DECRYPTION_KEY )
+			}
+			_, err = decryptor.DecryptObject( secret )
+			if err != nil {
+				return nil, fmt.Errorf( "Unable to decrypt %v: %v", fullName, err )
+			}
+		}
+		return secret, nil
+	}
+
+	secret, err := OC.Get( namespace, KIND_SECRET, name )
+	if err != nil {
+		return nil, err
+	}
+	return secret.Object, nil
+}
+
+// Returns the first rule matching a route, or nil.
+func (rt *RouteTransforms) rule( fullName string ) *preparedRouteTransform {
+	if strings.SplitN( fullName, "/", 2 )[0] != KIND_ROUTE {
+		return nil
+	}
+	for i := range rt.rules {
+		if rt.rules[i].match == "" || IsMatchedByKindNameList( fullName, rt.rules[i].match ) {
+			return &rt.rules[i]
+		}
+	}
+	return nil
+}
+
+// Applies the host of the first matching rule to a route. name is the
+// route's name after any renames.
+func (rt *RouteTransforms) ApplyHost( fullName string, name string, obj map[string]interface{} ) error {
+	rule := rt.rule( fullName )
+	if rule == nil || ( ! rule.clearHost && rule.host == nil ) {
+		return nil
+	}
+
+	spec := metadataMap( obj, true, "spec" )
+	if rule.clearHost {
+		Out.Info( "Clearing host of %v", fullName )
+		delete( spec, "host" )
+	} else {
+		var out bytes.Buffer
+		err := rule.host.Execute( &out, RouteHostContext{ Name: name, Namespace: rt.namespace, Domain: rule.domain, Version: rt.version } )
+		if err != nil {
+			return fmt.Errorf( "Unable to render host of %v: %v", fullName, err )
+		}
+		Out.Info( "Setting host of %v to %v", fullName, out.String() )
+		spec[ "host" ] = out.String()
+	}
+	delete( metadataMap( obj, false, "metadata", "annotations" ), "openshift.io/host.generated" )
+	return nil
+}
+
+// Applies the TLS material of the first matching rule to a route. It is
+// applied after the route is written so that keys are not stored. The
+// destination CA certificate is only set for reencrypt termination.
+func (rt *RouteTransforms) ApplyTLS( fullName string, obj map[string]interface{} ) {
+	rule := rt.rule( fullName )
+	if rule == nil || len( rule.tls ) == 0 {
+		return
+	}
+
+	tls := metadataMap( obj, false, "spec", "tls" )
+	termination, _ := tls[ "termination" ].(string)
+	switch termination {
+	case "edge", "reencrypt":
+		for field, pem := range rule.tls {
+			if field == "destinationCACertificate" && termination != "reencrypt" {
+				continue
+			}
+			tls[ field ] = pem
+		}
+		Out.Info( "Replacing TLS material of %v", fullName )
+	default:
+		Out.Warn( "Not replacing TLS material of %v; it requires edge or reencrypt termination", fullName )
+	}
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+	"encoding/base64"
+)
+
+func writeTestRoute( t *testing.T, dir string, name string, termination string ) string {
+	filename := filepath.Join( dir, name + ".json" )
+	data := `{ "kind": "Route", "metadata": { "name": "` + name + `" }, "spec": { "host": "old.example.com", "tls": { "termination": "` + termination + `" } } }`
+	if err := ioutil.WriteFile( filename, []byte( data ), 0600 ); err != nil {
+		t.Fatal( err )
+	}
+	return filename
+}
+
+func testRouteXR( t *testing.T, dir string ) *XR {
+	caFile := filepath.Join( dir, "ca.pem" )
+	if err := ioutil.WriteFile( caFile, []byte( "CA" ), 0600 ); err != nil {
+		t.Fatal( err )
+	}
+	xr := &XR{}
+	var rule RouteTransform
+	rule.Host = "{{.Name}}.{{.Domain}}"
+	rule.Domain = "apps.example.com"
+	rule.TLS = &RouteTLS{ DestinationCACertificateFile: caFile }
+	xr.Spec.ImportRules.Transforms.Routes = []RouteTransform{ rule }
+	return xr
+}
+
+func TestRouteTransformsRejectDestinationCAForEdge( t *testing.T ) {
+	dir := t.TempDir()
+	files := map[string]string{ KIND_ROUTE + "/web": writeTestRoute( t, dir, "web", "edge" ) }
+
+	_, err := NewRouteTransforms( testRouteXR( t, dir ), "demo", "v1", "", files, nil, nil )
+	if err == nil {
+		t.Fatal( "expected a destination CA certificate for an edge route to be rejected" )
+	}
+}
+
+func TestRouteTransformsApply( t *testing.T ) {
+	dir := t.TempDir()
+	files := map[string]string{ KIND_ROUTE + "/web": writeTestRoute( t, dir, "web", "reencrypt" ) }
+
+	rt, err := NewRouteTransforms( testRouteXR( t, dir ), "demo", "v1", "", files, nil, nil )
+	if err != nil {
+		t.Fatal( err )
+	}
+
+	obj := parseTestObject( t, `{ "kind": "Route", "metadata": { "name": "web" }, "spec": { "host": "old.example.com", "tls": { "termination": "reencrypt" } } }` )
+	if err := rt.ApplyHost( KIND_ROUTE + "/web", "x-web", obj ); err != nil {
+		t.Fatal( err )
+	}
+	if host := GetJSONPath( obj, "spec", "host" ); host != "x-web.apps.example.com" {
+		t.Errorf( "host %v, expected x-web.apps.example.com", host )
+	}
+	if ca := GetJSONPath( obj, "spec", "tls", "destinationCACertificate" ); ca != nil {
+		t.Errorf( "ApplyHost set TLS material: %v", ca )
+	}
+
+	rt.ApplyTLS( KIND_ROUTE + "/web", obj )
+	if ca := GetJSONPath( obj, "spec", "tls", "destinationCACertificate" ); ca != "CA" {
+		t.Errorf( "destinationCACertificate %v, expected CA", ca )
+	}
+}
+
+func testTLSRouteXR( secret string ) *XR {
+	xr := &XR{}
+	xr.Spec.ImportRules.Transforms.Routes = []RouteTransform{ { TLS: &RouteTLS{ Secret: secret } } }
+	return xr
+}
+
+func writeTestSecret( t *testing.T, dir string, name string, annotations string ) string {
+	filename := filepath.Join( dir, name + ".json" )
+	crt := base64.StdEncoding.EncodeToString( []byte( name + "-crt" ) )
+	key := base64.StdEncoding.EncodeToString( []byte( name + "-key" ) )
+	data := `{ "kind": "Secret", "metadata": { "name": "` + name + `", "annotations": { ` + annotations + ` } }, "data": { "tls.crt": "` + crt + `", "tls.key": "` + key + `" } }`
+	if err := ioutil.WriteFile( filename, []byte( data ), 0600 ); err != nil {
+		t.Fatal( err )
+	}
+	return filename
+}
+
+func TestRouteTransformsStagedTLSSecret( t *testing.T ) {
+	dir := t.TempDir()
+	liveSecret := testObject( "v1", "Secret", "demo", "live-tls", nil )
+	liveSecret.Object[ "data" ] = map[string]interface{}{
+		"tls.crt": base64.StdEncoding.EncodeToString( []byte( "live-crt" ) ),
+		"tls.key": base64.StdEncoding.EncodeToString( []byte( "live-key" ) ),
+	}
+	newTestSecretCluster( t, liveSecret )
+
+	files := map[string]string{
+		KIND_SECRET + "/tls": writeTestSecret( t, dir, "tls", "" ),
+		KIND_SECRET + "/redacted": writeTestSecret( t, dir, "redacted", `"` + ANNOTATION_REDACTED + `": "tls.crt,tls.key"` ),
+	}
+	renames := map[string]string{ KIND_SECRET + "/redacted": "live-tls" }
+
+	cases := []struct {
+		secret string
+		expected string // certificate, or empty for an error
+	}{
+		{ "tls", "tls-crt" }, // staged, not present in the namespace
+		{ "live-tls", "live-crt" }, // staged redacted under its imported name
+		{ "missing", "" },
+	}
+	for _, tc := range cases {
+		rt, err := NewRouteTransforms( testTLSRouteXR( tc.secret ), "demo", "v1", "", files, renames, nil )
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf( "secret %v: expected an error", tc.secret )
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf( "secret %v: %v", tc.secret, err )
+			continue
+		}
+		if crt := rt.rules[0].tls[ "certificate" ]; crt != tc.expected {
+			t.Errorf( "secret %v: certificate %q, expected %q", tc.secret, crt, tc.expected )
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	SECRETS_INCLUDE = "include"
+	SECRETS_REDACT = "redact"
+	SECRETS_SKIP = "skip"
+)
+
+// Returns the export secrets mode of the XR.
+func SecretsMode( xr *XR ) (string, error) {
+	switch mode := xr.Spec.ExportRules.Secrets.Mode; mode {
+	case "":
+		return SECRETS_INCLUDE, nil
+	case SECRETS_INCLUDE, SECRETS_REDACT, SECRETS_SKIP:
+		return mode, nil
+	default:
+		return "", fmt.Errorf( "Unsupported secrets mode (must be %v, %v or %v): %q", SECRETS_INCLUDE, SECRETS_REDACT, SECRETS_SKIP, mode )
+	}
+}
+
+// Replaces every secret value with an empty placeholder, folding stringData
+// into data, and annotates the secret with the redacted keys.
+func RedactSecret( obj map[string]interface{} ) {
+	data, _ := obj["data"].(map[string]interface{})
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	stringData, _ := obj["stringData"].(map[string]interface{})
+	for key := range stringData {
+		data[ key ] = ""
+	}
+	delete( obj, "stringData" )
+
+	var keys []string
+	for key := range data {
+		data[ key ] = ""
+		keys = append( keys, key )
+	}
+	sort.Strings( keys )
+	obj["data"] = data
+
+	SetAnnotation( obj, ANNOTATION_REDACTED, strings.Join( keys, "," ) )
+}
+
+func IsRedactedSecret( obj map[string]interface{} ) bool {
+	_, ok := GetJSONPath( obj, "metadata", "annotations", ANNOTATION_REDACTED ).(string)
+	return ok
+}
+
+// Returns the live secret which supplies the values of a redacted secret.
+func liveRedactedSecret( namespace string, name string ) (map[string]interface{}, error) {
+	live, err := OC.Get( namespace, KIND_SECRET, name )
+	if IsNotFound( err ) {
+		return nil, fmt.Errorf( "Secret %v was exported redacted and does not exist in namespace %v; create it before replacing", name, namespace )
+	}
+	if err != nil {
+		return nil, err
+	}
+	return live.Object, nil
+}
+
+// Returns an error if a redacted secret cannot be restored from the namespace.
+func CheckRedactedSecret( namespace string, name string ) error {
+	_, err := liveRedactedSecret( namespace, name )
+	return err
+}
+
+// Fills a redacted secret with the values of the live secret of the same
+// name in the namespace. Fails if the secret does not exist.
+func RestoreRedactedSecret( namespace string, obj map[string]interface{} ) error {
+	name, _ := GetJSONPath( obj, "metadata", "name" ).(string)
+	live, err := liveRedactedSecret( namespace, name )
+	if err != nil {
+		return err
+	}
+
+	liveData, _ := live["data"].(map[string]interface{})
+	redactedKeys, _ := GetJSONPath( obj, "metadata", "annotations", ANNOTATION_REDACTED ).(string)
+	for _, key := range strings.Split( redactedKeys, "," ) {
+		if _, ok := liveData[ key ]; key != "" && !ok {
+			Out.Warn( "Live secret %v does not have exported key: %v", name, key )
+		}
+	}
+
+	if liveData == nil {
+		liveData = map[string]interface{}{}
+	}
+	obj["data"] = liveData
+	delete( obj, "stringData" )
+	return nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Creates a test cluster which serves secrets.
+func newTestSecretCluster( t *testing.T, objs... runtime.Object ) *Cluster {
+	return newTestClusterWithResources( t, []*metav1.APIResourceList{ {
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{ Name: "secrets", SingularName: "secret", Kind: "Secret", Namespaced: true, Verbs: []string{ "list", "get", "create", "delete" } },
+		},
+	} }, objs... )
+}
+
+func TestSecretsMode( t *testing.T ) {
+	cases := []struct {
+		mode string
+		expected string // empty for an error
+	}{
+		{ "", SECRETS_INCLUDE },
+		{ SECRETS_INCLUDE, SECRETS_INCLUDE },
+		{ SECRETS_REDACT, SECRETS_REDACT },
+		{ SECRETS_SKIP, SECRETS_SKIP },
+		{ "Skip", "" },
+		{ "encrypt", "" },
+	}
+	for _, tc := range cases {
+		xr := &XR{}
+		xr.Spec.ExportRules.Secrets.Mode = tc.mode
+		mode, err := SecretsMode( xr )
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf( "SecretsMode(%q): expected an error", tc.mode )
+			}
+			continue
+		}
+		if err != nil || mode != tc.expected {
+			t.Errorf( "SecretsMode(%q) = %v, %v; expected %v", tc.mode, mode, err, tc.expected )
+		}
+	}
+}
+
+func TestRedactSecret( t *testing.T ) {
+	cases := []struct {
+		obj string
+		expected string
+	}{
+		{ `{ "metadata": { "name": "db" }, "data": { "user": "YWRtaW4=", "password": "c2VjcmV0" } }`,
+			`{ "metadata": { "name": "db", "annotations": { "` + ANNOTATION_REDACTED + `": "password,user" } }, "data": { "user": "", "password": "" } }` },
+		// stringData is folded into data
+		{ `{ "metadata": { "name": "db" }, "data": { "user": "YWRtaW4=" }, "stringData": { "token": "t" } }`,
+			`{ "metadata": { "name": "db", "annotations": { "` + ANNOTATION_REDACTED + `": "token,user" } }, "data": { "user": "", "token": "" } }` },
+		{ `{ "metadata": { "name": "empty" } }`,
+			`{ "metadata": { "name": "empty", "annotations": { "` + ANNOTATION_REDACTED + `": "" } }, "data": {} }` },
+	}
+	for _, tc := range cases {
+		obj := parseTestObject( t, tc.obj )
+		if IsRedactedSecret( obj ) {
+			t.Errorf( "%v is already redacted", tc.obj )
+		}
+		RedactSecret( obj )
+		if expected := parseTestObject( t, tc.expected ); !reflect.DeepEqual( obj, expected ) {
+			t.Errorf( "RedactSecret(%v) = %v, expected %v", tc.obj, obj, expected )
+		}
+		if !IsRedactedSecret( obj ) {
+			t.Errorf( "RedactSecret(%v) is not recognized as redacted", tc.obj )
+		}
+	}
+}
+
+func TestRestoreRedactedSecret( t *testing.T ) {
+	live := testObject( "v1", "Secret", "demo", "db", nil )
+	live.Object[ "data" ] = map[string]interface{}{ "user": "YWRtaW4=", "password": "bmV3" }
+	newTestSecretCluster( t, live )
+
+	obj := parseTestObject( t, `{ "metadata": { "name": "db" }, "data": { "user": "YWRtaW4=", "password": "c2VjcmV0" }, "stringData": { "token": "t" } }` )
+	RedactSecret( obj )
+	if err := CheckRedactedSecret( "demo", "db" ); err != nil {
+		t.Fatal( err )
+	}
+	if err := RestoreRedactedSecret( "demo", obj ); err != nil {
+		t.Fatal( err )
+	}
+	expected := map[string]interface{}{ "user": "YWRtaW4=", "password": "bmV3" }
+	if data := obj[ "data" ]; !reflect.DeepEqual( data, expected ) {
+		t.Errorf( "restored data = %v, expected %v", data, expected )
+	}
+	if _, ok := obj[ "stringData" ]; ok {
+		t.Errorf( "stringData was not removed: %v", obj )
+	}
+
+	if err := CheckRedactedSecret( "demo", "missing" ); err == nil {
+		t.Error( "expected a missing live secret to be reported" )
+	}
+	missing := parseTestObject( t, `{ "metadata": { "name": "missing" }, "data": { "user": "" } }` )
+	RedactSecret( missing )
+	if err := RestoreRedactedSecret( "demo", missing ); err == nil {
+		t.Error( "expected a missing live secret to prevent restoring" )
+	}
+}
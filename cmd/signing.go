@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"io/ioutil"
+)
+
+const (
+	SIGNING_FORMAT_SSH = "ssh"
+	SIGNING_FORMAT_OPENPGP = "openpgp"
+)
+
+// Returns the git configuration arguments necessary to sign a commit
+// with the specified key. format may be "ssh" or "openpgp" (the default).
+func SigningConfigArgs( format, key string ) ([]string, error) {
+	format = strings.ToLower( strings.TrimSpace( format ) )
+	if format == "" {
+		format = SIGNING_FORMAT_OPENPGP
+	}
+
+	if format != SIGNING_FORMAT_SSH && format != SIGNING_FORMAT_OPENPGP {
+		return nil, fmt.Errorf( "Unsupported signing format (must be %v or %v): %v", SIGNING_FORMAT_SSH, SIGNING_FORMAT_OPENPGP, format )
+	}
+
+	return []string{
+		"-c", "gpg.format=" + format,
+		"-c", "user.signingkey=" + key,
+		"-c", "commit.gpgsign=true",
+	}, nil
+}
+
+// SSH public keys are listed in allowedSigners as "<keytype> <base64-key> [comment]".
+// Anything else is treated as an OpenPGP key fingerprint.
+func isSSHPublicKey( entry string ) bool {
+	for _, prefix := range []string{ "ssh-", "ecdsa-", "sk-" } {
+		if strings.HasPrefix( entry, prefix ) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeFingerprint( fp string ) string {
+	return strings.ToUpper( strings.Replace( strings.TrimSpace( fp ), " ", "", -1 ) )
+}
+
+// Verifies that the HEAD commit of the git repository is signed by one of the
+// keys in allowedSigners. Entries may be SSH public keys or OpenPGP
+// fingerprints. OpenPGP public keys must already be present in the user's keyring.
+func VerifyHeadSignature( git *GitCmd, allowedSigners []string ) error {
+	var sshKeys []string
+	pgpFingerprints := make( map[string]struct{} )
+
+	for _, entry := range allowedSigners {
+		entry = strings.TrimSpace( entry )
+		if entry == "" {
+			continue
+		}
+		if isSSHPublicKey( entry ) {
+			sshKeys = append( sshKeys, entry )
+		} else {
+			pgpFingerprints[ normalizeFingerprint( entry ) ] = struct{}{}
+		}
+	}
+
+	// Always supply an allowed signers file so that ssh signatures by unknown
+	// keys are reported as such rather than as unverifiable.
+	f, err := ioutil.TempFile( "", "xrsigners" )
+	if err != nil {
+		return fmt.Errorf( "Unable to create allowed signers file: %v", err )
+	}
+	defer os.Remove( f.Name() )
+
+	for _, key := range sshKeys {
+		// git looks principals up by key, so a fixed principal name suffices
+		fmt.Fprintf( f, "xrutil %v\n", key )
+	}
+	f.Close()
+
+	so, se, err := git.Exec( "-c", "gpg.ssh.allowedSignersFile=" + f.Name(), "log", "-1", "--format=%G?%n%GF%n%GP", "HEAD" )
+	if err != nil {
+		return fmt.Errorf( "Unable to read HEAD commit signature [%v]: %v", err, se )
+	}
+
+	lines := strings.Split( so, "\n" )
+	for len( lines ) < 3 {
+		lines = append( lines, "" )
+	}
+	status, fingerprint, primary := strings.TrimSpace( lines[0] ), lines[1], lines[2]
+
+	switch status {
+	case "N":
+		return fmt.Errorf( "HEAD commit is not signed" )
+	case "B":
+		return fmt.Errorf( "HEAD commit has a bad signature" )
+	case "E":
+		return fmt.Errorf( "HEAD commit signature cannot be checked; is the signing key available? %v", se )
+	case "X", "Y", "R":
+		return fmt.Errorf( "HEAD commit is signed with an expired or revoked key (%v): %v", status, fingerprint )
+	}
+
+	if strings.HasPrefix( fingerprint, "SHA256:" ) {
+		// ssh signatures only verify as good when the key is in the allowed signers file
+		if status == "G" {
+			Out.Debug( "HEAD commit signed by allowed SSH key: %v", fingerprint )
+			return nil
+		}
+		return fmt.Errorf( "HEAD commit is signed by an SSH key which is not in allowedSigners: %v", fingerprint )
+	}
+
+	for _, fp := range []string{ fingerprint, primary } {
+		if _, ok := pgpFingerprints[ normalizeFingerprint( fp ) ]; ok && fp != "" {
+			Out.Debug( "HEAD commit signed by allowed OpenPGP key: %v", fp )
+			return nil
+		}
+	}
+
+	return fmt.Errorf( "HEAD commit is signed by a key which is not in allowedSigners: %v", fingerprint )
+}
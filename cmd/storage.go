@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+)
+
+const ANNOTATION_STORAGE_CLASS = "volume.beta.kubernetes.io/storage-class"
+
+// Annotations which bind a claim to a volume or node in the source cluster.
+var volumeBindingAnnotations = []string{
+	"pv.kubernetes.io/bind-completed",
+	"pv.kubernetes.io/bound-by-controller",
+	"volume.beta.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/selected-node",
+}
+
+// Maps a storage class name. A mapping to "" removes the class so that the
+// target cluster's default applies; "*" maps every unlisted class.
+func mapStorageClass( mappings map[string]string, class string ) (string, bool) {
+	if mapped, ok := mappings[ class ]; ok {
+		return mapped, true
+	}
+	if mapped, ok := mappings[ "*" ]; ok {
+		return mapped, true
+	}
+	return class, false
+}
+
+// Maps the storage class of a claim spec in place.
+func mapClaimStorageClass( mappings map[string]string, fullName string, claim map[string]interface{} ) {
+	spec := metadataMap( claim, false, "spec" )
+	if class, ok := spec[ "storageClassName" ].(string); ok {
+		if mapped, ok := mapStorageClass( mappings, class ); ok {
+			Out.Info( "Mapping storage class of %v: %q -> %q", fullName, class, mapped )
+			if mapped == "" {
+				delete( spec, "storageClassName" )
+			} else {
+				spec[ "storageClassName" ] = mapped
+			}
+		}
+	}
+
+	annotations := metadataMap( claim, false, "metadata", "annotations" )
+	if class, ok := annotations[ ANNOTATION_STORAGE_CLASS ].(string); ok {
+		if mapped, ok := mapStorageClass( mappings, class ); ok {
+			if mapped == "" {
+				delete( annotations, ANNOTATION_STORAGE_CLASS )
+			} else {
+				annotations[ ANNOTATION_STORAGE_CLASS ] = mapped
+			}
+		}
+	}
+}
+
+// Applies storage class mappings to persistent volume claims and stateful
+// set claim templates, and removes claims' bindings to source cluster
+// volumes unless they are preserved.
+func ApplyStorageTransforms( xr *XR, fullName string, kind string, obj map[string]interface{} ) {
+	storage := xr.Spec.ImportRules.Transforms.Storage
+
+	switch kind {
+	case KIND_PVC:
+		mapClaimStorageClass( storage.ClassMappings, fullName, obj )
+		if ! storage.PreserveVolumeBindings {
+			if spec := metadataMap( obj, false, "spec" ); spec[ "volumeName" ] != nil {
+				Out.Info( "Removing volume binding of %v", fullName )
+				delete( spec, "volumeName" )
+			}
+			annotations := metadataMap( obj, false, "metadata", "annotations" )
+			for _, annotation := range volumeBindingAnnotations {
+				delete( annotations, annotation )
+			}
+		}
+	case KIND_STATEFULSET:
+		templates, _ := GetJSONPath( obj, "spec", "volumeClaimTemplates" ).([]interface{})
+		for _, t := range templates {
+			if claim, ok := t.(map[string]interface{}); ok {
+				mapClaimStorageClass( storage.ClassMappings, fullName, claim )
+			}
+		}
+	}
+}
+
+// Returns true if the claim exists in the namespace and is bound to a
+// volume. Replacing it would release the volume and may destroy its data.
+func IsBoundClaim( namespace string, name string ) (bool, error) {
+	live, err := OC.Get( namespace, KIND_PVC, name )
+	if IsNotFound( err ) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf( "Unable to read persistent volume claim %v: %v", name, err )
+	}
+	phase, _ := GetJSONPath( live.Object, "status", "phase" ).(string)
+	return phase == "Bound", nil
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplyStorageTransforms( t *testing.T ) {
+	claim := `{
+		"kind": "PersistentVolumeClaim",
+		"metadata": { "name": "data", "annotations": {
+			"pv.kubernetes.io/bind-completed": "yes",
+			"volume.kubernetes.io/selected-node": "node-1",
+			"volume.beta.kubernetes.io/storage-class": "gp2",
+			"keep": "me"
+		} },
+		"spec": { "storageClassName": "gp2", "volumeName": "pv-1" }
+	}`
+	statefulSet := `{
+		"kind": "StatefulSet",
+		"spec": { "volumeClaimTemplates": [
+			{ "metadata": { "name": "a" }, "spec": { "storageClassName": "gp2" } },
+			{ "metadata": { "name": "b" }, "spec": { "storageClassName": "fast" } },
+			{ "metadata": { "name": "c" }, "spec": {} }
+		] }
+	}`
+
+	cases := []struct {
+		name string
+		mappings map[string]string
+		preserve bool
+		kind string
+		obj string
+		expected string
+	}{
+		{ "mapped claim", map[string]string{ "gp2": "standard" }, false, KIND_PVC, claim,
+			`{ "kind": "PersistentVolumeClaim", "metadata": { "name": "data", "annotations": { "volume.beta.kubernetes.io/storage-class": "standard", "keep": "me" } }, "spec": { "storageClassName": "standard" } }` },
+		// Mapping to "" leaves the class to the target cluster's default
+		{ "default class", map[string]string{ "*": "" }, true, KIND_PVC, claim,
+			`{ "kind": "PersistentVolumeClaim", "metadata": { "name": "data", "annotations": { "pv.kubernetes.io/bind-completed": "yes", "volume.kubernetes.io/selected-node": "node-1", "keep": "me" } }, "spec": { "volumeName": "pv-1" } }` },
+		{ "unmapped claim", map[string]string{ "fast": "standard" }, true, KIND_PVC, claim, claim },
+		{ "claim templates", map[string]string{ "gp2": "standard", "*": "premium" }, false, KIND_STATEFULSET, statefulSet,
+			`{ "kind": "StatefulSet", "spec": { "volumeClaimTemplates": [
+				{ "metadata": { "name": "a" }, "spec": { "storageClassName": "standard" } },
+				{ "metadata": { "name": "b" }, "spec": { "storageClassName": "premium" } },
+				{ "metadata": { "name": "c" }, "spec": {} }
+			] } }` },
+		{ "other kinds", map[string]string{ "*": "standard" }, false, KIND_CONFIGMAP, `{ "spec": { "storageClassName": "gp2" } }`,
+			`{ "spec": { "storageClassName": "gp2" } }` },
+	}
+	for _, tc := range cases {
+		xr := &XR{}
+		xr.Spec.ImportRules.Transforms.Storage.ClassMappings = tc.mappings
+		xr.Spec.ImportRules.Transforms.Storage.PreserveVolumeBindings = tc.preserve
+		obj := parseTestObject( t, tc.obj )
+		ApplyStorageTransforms( xr, tc.kind + "/data", tc.kind, obj )
+		if expected := parseTestObject( t, tc.expected ); !reflect.DeepEqual( obj, expected ) {
+			t.Errorf( "%v:\n%v\nexpected\n%v", tc.name, obj, expected )
+		}
+	}
+}
+
+func TestIsBoundClaim( t *testing.T ) {
+	bound := testObject( "v1", "PersistentVolumeClaim", "demo", "bound", nil )
+	bound.Object[ "status" ] = map[string]interface{}{ "phase": "Bound" }
+	pending := testObject( "v1", "PersistentVolumeClaim", "demo", "pending", nil )
+	pending.Object[ "status" ] = map[string]interface{}{ "phase": "Pending" }
+	newTestClusterWithResources( t, []*metav1.APIResourceList{ {
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{ Name: "persistentvolumeclaims", SingularName: "persistentvolumeclaim", Kind: "PersistentVolumeClaim", Namespaced: true, ShortNames: []string{ "pvc" }, Verbs: []string{ "list", "get", "create", "delete" } },
+		},
+	} }, bound, pending )
+
+	cases := []struct {
+		name string
+		expected bool
+	}{
+		{ "bound", true },
+		{ "pending", false },
+		{ "missing", false },
+	}
+	for _, tc := range cases {
+		isBound, err := IsBoundClaim( "demo", tc.name )
+		if err != nil {
+			t.Fatalf( "IsBoundClaim(%v): %v", tc.name, err )
+		}
+		if isBound != tc.expected {
+			t.Errorf( "IsBoundClaim(%v) = %v, expected %v", tc.name, isBound, tc.expected )
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"io"
+	"bytes"
+	"strings"
+	"io/ioutil"
+	"path/filepath"
+)
+
+const (
+	STORE_GIT = "git"
+	STORE_DIRECTORY = "directory"
+	STORE_TARBALL = "tarball"
+	STORE_OCI = "oci"
+)
+
+// An ObjectStore persists the versions of an ObjectRepository. Export and
+// replace only interact with storage through this interface; object files
+// are always read from and written to a local directory.
+type ObjectStore interface {
+	// Returns the local directory containing <kind>/<name> object files.
+	ObjectDir() string
+
+	// Populates ObjectDir with the objects of an existing version.
+	Fetch( version string ) error
+
+	// Prepares ObjectDir to receive a new export of version. Objects which
+	// are not written again are removed from the version when it is published.
+	Stage( version string ) error
+
+	// Reports the differences between ObjectDir and the prior content of
+	// the staged version.
+	Changes() (*ChangeSet, error)
+
+	// Restores modified objects to their prior content when equivalent
+	// reports that they do not meaningfully differ.
+	RevertEquivalent( cs *ChangeSet, equivalent func( old, new string ) bool ) error
+
+	// Persists the content of ObjectDir as the staged version.
+	Publish( message string ) error
+
+	// Releases local resources held by the store.
+	Close()
+}
+
+// Options which influence how an ObjectStore stages and publishes versions.
+type StoreOptions struct {
+	Overwrite bool
+	ReviewBranch string
+	SigningKey string
+	SigningFormat string
+	Preserve bool
+}
+
+// Creates the ObjectStore for the XR's spec.type.
+func OpenObjectStore( xr *XR, opts StoreOptions ) (ObjectStore, error) {
+	if xr.Spec.Type != STORE_GIT {
+		if opts.ReviewBranch != "" {
+			return nil, fmt.Errorf( "Review branches are only supported by git ObjectRepositories" )
+		}
+		if opts.SigningKey != "" || len( xr.Spec.Git.AllowedSigners ) > 0 {
+			return nil, fmt.Errorf( "Commit signing is only supported by git ObjectRepositories" )
+		}
+	}
+
+	switch xr.Spec.Type {
+	case STORE_GIT:
+		return newGitStore( xr, opts )
+	case STORE_DIRECTORY:
+		return newDirectoryStore( xr, opts )
+	case STORE_TARBALL:
+		return newTarballStore( xr, opts )
+	case STORE_OCI:
+		return newOCIStore( xr, opts )
+	}
+	return nil, fmt.Errorf( "Unsupported ObjectRepository type: %v", xr.Spec.Type )
+}
+
+// Common implementation for stores which keep versions outside of a
+// version control system. The prior content of a staged version is kept
+// alongside the new export so that changes can be computed by comparison.
+type localStore struct {
+	workDir string
+	objectDir string
+	priorDir string
+	format string
+	overwrite bool
+	preserve bool
+	version string
+}
+
+func newLocalStore( xr *XR, opts StoreOptions ) (*localStore, error) {
+	workDir, err := ioutil.TempDir( "", "xrstore" )
+	if err != nil {
+		return nil, fmt.Errorf( "Error creating temporary directory for object storage: %v", err )
+	}
+
+	ls := &localStore{
+		workDir: workDir,
+		objectDir: filepath.Join( workDir, "objects" ),
+		priorDir: filepath.Join( workDir, "prior" ),
+		format: xr.Spec.Format,
+		overwrite: opts.Overwrite,
+		preserve: opts.Preserve,
+	}
+
+	for _, dir := range []string{ ls.objectDir, ls.priorDir } {
+		if err := os.MkdirAll( dir, 0700 ); err != nil {
+			os.RemoveAll( workDir )
+			return nil, fmt.Errorf( "Error creating object storage directory (%v): %v", dir, err )
+		}
+	}
+
+	return ls, nil
+}
+
+func (ls *localStore) ObjectDir() string {
+	return ls.objectDir
+}
+
+func (ls *localStore) Close() {
+	if ls.preserve {
+		Out.Warn( "The working object directory will not be removed: %v", ls.workDir )
+		return
+	}
+	os.RemoveAll( ls.workDir )
+}
+
+// Returns kind/name => path for each object file beneath dir.
+func (ls *localStore) objectFiles( dir string ) map[string]string {
+	m := make( map[string]string )
+	filepath.Walk( dir, func( path string, info os.FileInfo, err error ) error {
+		if err != nil || ! info.Mode().IsRegular() || ! strings.HasSuffix( path, "." + ls.format ) {
+			return nil
+		}
+		// Normalized so that legacy kind directory names match current ones
+		m[ NormalizeType( GetFullObjectNameFromPath( path ) ) ] = path
+		return nil
+	})
+	return m
+}
+
+func (ls *localStore) Changes() (*ChangeSet, error) {
+	prior := ls.objectFiles( ls.priorDir )
+	current := ls.objectFiles( ls.objectDir )
+
+	cs := &ChangeSet{}
+	for fullName, path := range current {
+		priorPath, ok := prior[ fullName ]
+		if ! ok {
+			cs.Added = append( cs.Added, fullName )
+			continue
+		}
+		same, err := sameFileContent( priorPath, path )
+		if err != nil {
+			return nil, err
+		}
+		if ! same {
+			cs.Modified = append( cs.Modified, fullName )
+		}
+	}
+
+	for fullName := range prior {
+		if _, ok := current[ fullName ]; ! ok {
+			cs.Deleted = append( cs.Deleted, fullName )
+		}
+	}
+
+	cs.sort()
+	return cs, nil
+}
+
+func (ls *localStore) RevertEquivalent( cs *ChangeSet, equivalent func( old, new string ) bool ) error {
+	prior := ls.objectFiles( ls.priorDir )
+	current := ls.objectFiles( ls.objectDir )
+
+	var modified []string
+	for _, fullName := range cs.Modified {
+		oldContent, err := ioutil.ReadFile( prior[ fullName ] )
+		if err != nil {
+			return fmt.Errorf( "Unable to read prior content of %v: %v", fullName, err )
+		}
+		newContent, err := ioutil.ReadFile( current[ fullName ] )
+		if err != nil {
+			return fmt.Errorf( "Unable to read new content of %v: %v", fullName, err )
+		}
+
+		if ! equivalent( string( oldContent ), string( newContent ) ) {
+			modified = append( modified, fullName )
+			continue
+		}
+
+		Out.Debug( "Object is unchanged aside from generated content: %v", fullName )
+		if err := ioutil.WriteFile( current[ fullName ], oldContent, 0600 ); err != nil {
+			return fmt.Errorf( "Unable to revert %v: %v", fullName, err )
+		}
+	}
+	cs.Modified = modified
+	return nil
+}
+
+func sameFileContent( a, b string ) (bool, error) {
+	aContent, err := ioutil.ReadFile( a )
+	if err != nil {
+		return false, fmt.Errorf( "Unable to read object file (%v): %v", a, err )
+	}
+	bContent, err := ioutil.ReadFile( b )
+	if err != nil {
+		return false, fmt.Errorf( "Unable to read object file (%v): %v", b, err )
+	}
+	return bytes.Equal( bytes.TrimSpace( aContent ), bytes.TrimSpace( bContent ) ), nil
+}
+
+// Recursively copies the content of the from directory into the to directory.
+func copyDir( from, to string ) error {
+	return filepath.Walk( from, func( path string, info os.FileInfo, err error ) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel( from, path )
+		if err != nil {
+			return err
+		}
+		target := filepath.Join( to, rel )
+
+		if info.IsDir() {
+			return os.MkdirAll( target, 0700 )
+		}
+
+		if ! info.Mode().IsRegular() {
+			return nil
+		}
+
+		src, err := os.Open( path )
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		dst, err := os.OpenFile( target, os.O_CREATE | os.O_TRUNC | os.O_WRONLY, 0600 )
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+
+		_, err = io.Copy( dst, src )
+		return err
+	})
+}
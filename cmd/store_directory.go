@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Stores each version as a plain directory tree: <path>/<prefix><version>/<kind>/<name>.json
+type directoryStore struct {
+	*localStore
+	path string
+	prefix string
+}
+
+func newDirectoryStore( xr *XR, opts StoreOptions ) (ObjectStore, error) {
+	if xr.Spec.Directory.Path == "" {
+		return nil, fmt.Errorf( "No directory path specified" )
+	}
+
+	ls, err := newLocalStore( xr, opts )
+	if err != nil {
+		return nil, err
+	}
+
+	return &directoryStore{
+		localStore: ls,
+		path: xr.Spec.Directory.Path,
+		prefix: xr.Spec.Directory.Prefix,
+	}, nil
+}
+
+func (ds *directoryStore) versionDir( version string ) string {
+	return filepath.Join( ds.path, ds.prefix + version )
+}
+
+func (ds *directoryStore) Fetch( version string ) error {
+	versionDir := ds.versionDir( version )
+	if _, err := os.Stat( versionDir ); err != nil {
+		return fmt.Errorf( "Version does not exist (%v): %v", versionDir, err )
+	}
+
+	Out.Info( "Reading %v", versionDir )
+	if err := copyDir( versionDir, ds.objectDir ); err != nil {
+		return fmt.Errorf( "Error reading version directory (%v): %v", versionDir, err )
+	}
+	return nil
+}
+
+func (ds *directoryStore) Stage( version string ) error {
+	ds.version = version
+	versionDir := ds.versionDir( version )
+
+	if _, err := os.Stat( versionDir ); err == nil {
+		if ! ds.overwrite {
+			return fmt.Errorf( "Version already exists and --overwrite was not specified: %v", versionDir )
+		}
+		if err := copyDir( versionDir, ds.priorDir ); err != nil {
+			return fmt.Errorf( "Error reading existing version directory (%v): %v", versionDir, err )
+		}
+	}
+
+	return nil
+}
+
+func (ds *directoryStore) Publish( message string ) error {
+	versionDir := ds.versionDir( ds.version )
+
+	if err := os.MkdirAll( ds.path, 0700 ); err != nil {
+		return fmt.Errorf( "Error creating repository directory (%v): %v", ds.path, err )
+	}
+
+	// Write the new version beside the old and swap them so that a failure
+	// part way through never leaves a partially written version behind.
+	staging := versionDir + ".tmp"
+	os.RemoveAll( staging )
+	if err := copyDir( ds.objectDir, staging ); err != nil {
+		os.RemoveAll( staging )
+		return fmt.Errorf( "Error writing version directory (%v): %v", staging, err )
+	}
+
+	if err := os.RemoveAll( versionDir ); err != nil {
+		return fmt.Errorf( "Error removing prior version directory (%v): %v", versionDir, err )
+	}
+
+	if err := os.Rename( staging, versionDir ); err != nil {
+		return fmt.Errorf( "Error moving version directory into place (%v): %v", versionDir, err )
+	}
+
+	Out.Info( "Published version directory: %v", versionDir )
+	Out.Debug( "Version message: %v", message )
+	return nil
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+)
+
+// Stores each version as a git branch: <prefix><version>
+type gitStore struct {
+	xr *XR
+	git *GitCmd
+	opts StoreOptions
+	branchName string
+	commitBranch string
+	priorRef string // the version being replaced; changes are reported against it
+}
+
+func newGitStore( xr *XR, opts StoreOptions ) (ObjectStore, error) {
+	if xr.Spec.Git.URI == "" {
+		return nil, fmt.Errorf( "No Git URI specified")
+	}
+
+	git, err := PrepGitDir( xr )
+	if err != nil {
+		return nil, fmt.Errorf( "Error initializing git repository: %v", err )
+	}
+
+	return &gitStore{ xr: xr, git: git, opts: opts }, nil
+}
+
+func (gs *gitStore) ObjectDir() string {
+	return gs.git.objectDir
+}
+
+func (gs *gitStore) Close() {
+	if gs.opts.Preserve {
+		Out.Warn( "The working git directory will not be removed: %v", gs.git.repoDir )
+		return
+	}
+	os.RemoveAll( gs.git.repoDir )
+}
+
+func (gs *gitStore) Fetch( version string ) error {
+	branchName := gs.xr.Spec.Git.Branch.Prefix + version
+
+	_,se,err := gs.git.Exec( "checkout", branchName )
+	if err != nil {
+		return fmt.Errorf( "Error checking out git branch (%v) [%v]: %v", branchName, err, se )
+	}
+
+	if len( gs.xr.Spec.Git.AllowedSigners ) > 0 {
+		err = VerifyHeadSignature( gs.git, gs.xr.Spec.Git.AllowedSigners )
+		if err != nil {
+			return fmt.Errorf( "Refusing to import from git branch (%v): %v", branchName, err )
+		}
+		Out.Info( "Verified signature of git branch: %v", branchName )
+	}
+
+	return nil
+}
+
+func (gs *gitStore) Stage( version string ) error {
+	git := gs.git
+	baseRef := gs.xr.Spec.Git.Branch.BaseRef
+	branchName := gs.xr.Spec.Git.Branch.Prefix + version
+
+	gs.branchName = branchName
+
+	// The branch the export is committed to. In review mode, this is a side
+	// branch based on the version branch which can be merged after review.
+	gs.commitBranch = branchName
+
+	// See if branch name already exists
+	_,se,err := git.Exec( "checkout", branchName  )
+	versionExists := err == nil
+
+	// Whichever branch receives the commit, changes are those relative to the
+	// current version, or to the base ref for a new version.
+	gs.priorRef = baseRef
+	if versionExists {
+		gs.priorRef = branchName
+	}
+
+	if gs.opts.ReviewBranch != "" {
+		if gs.opts.ReviewBranch == branchName {
+			return fmt.Errorf( "Review branch must differ from the version branch: %v", branchName )
+		}
+		gs.commitBranch = gs.opts.ReviewBranch
+
+		// An existing review branch (local or on origin) is continued so that
+		// the push is a fast-forward of what reviewers have already seen.
+		_,_,err = git.Exec( "checkout", gs.commitBranch )
+		if err == nil {
+			Out.Info( "Continuing existing review branch: %v", gs.commitBranch )
+		} else {
+			startRef := branchName
+			if ! versionExists {
+				Out.Warn( "Version branch does not exist yet (%v); review branch will be based on %v", branchName, baseRef )
+				startRef = baseRef
+			}
+
+			_,se,err = git.Exec( "checkout", "-b", gs.commitBranch, startRef )
+			if err != nil {
+				return fmt.Errorf( "Error creating review branch (%v) from (%v) [%v]: %v", gs.commitBranch, startRef, err, se )
+			}
+		}
+	} else {
+
+		if versionExists && !gs.opts.Overwrite {
+			return fmt.Errorf( "Branch already exists and --overwrite was not specified (%v)", branchName )
+		}
+
+		_,se,err = git.Exec( "branch", branchName, baseRef )
+		if err != nil {
+			Out.Warn( "Error while creating branch (%v) [%v]: %v", branchName, err, se )
+		}
+
+		_,se,err = git.Exec( "checkout", branchName )
+
+		if err != nil {
+			return fmt.Errorf( "Error checking out git branch (%v) [%v]: %v", branchName, err, se )
+		}
+	}
+
+	headCommitId,se,err := git.Exec( "rev-parse", "HEAD" ) // Store the current HEAD commit ID
+
+	if err != nil {
+		return fmt.Errorf( "Unable to determine HEAD commit id for branch (%v) [%v]: %v", gs.commitBranch, err, se )
+	}
+
+	_,se,err = git.Exec( "reset", "--hard", baseRef )
+
+	if err != nil {
+		return fmt.Errorf( "Error hard reseting git branch (%v) to (%v) [%v]: %v", gs.commitBranch, baseRef, err, se )
+	}
+
+	_,se,err = git.Exec( "reset", "--soft", headCommitId )
+
+	if err != nil {
+		return fmt.Errorf( "Error soft reseting git branch (%v) to (%v) [%v]: %v", gs.commitBranch, headCommitId, err, se )
+	}
+
+	return nil
+}
+
+func (gs *gitStore) Changes() (*ChangeSet, error) {
+	_,se,err := gs.git.Exec( "add", "." )
+
+	if err != nil {
+		return nil, fmt.Errorf( "Error adding tracked files to git branch (%v) [%v]: %v", gs.commitBranch, err, se )
+	}
+
+	return gs.git.StagedChanges( gs.xr, gs.priorRef )
+}
+
+func (gs *gitStore) RevertEquivalent( cs *ChangeSet, equivalent func( old, new string ) bool ) error {
+	return gs.git.RevertEquivalent( gs.xr, gs.priorRef, cs, equivalent )
+}
+
+func (gs *gitStore) Publish( message string ) error {
+	git := gs.git
+
+	var commitArgs []string
+	if gs.opts.SigningKey != "" {
+		var err error
+		commitArgs, err = SigningConfigArgs( gs.opts.SigningFormat, gs.opts.SigningKey )
+		if err != nil {
+			return fmt.Errorf( "Invalid commit signing configuration: %v", err )
+		}
+		Out.Info( "Signing commit with key: %v", gs.opts.SigningKey )
+	}
+
+	commitArgs = append( commitArgs, "commit", "-m", message )
+	_,se,err := git.Exec( commitArgs... )
+
+	if err != nil {
+		return fmt.Errorf( "Error committing files to git branch (%v) [%v]: %v", gs.commitBranch, err, se )
+	}
+
+	_,se,err = git.Exec( "push", "--set-upstream", "origin", gs.commitBranch )
+
+	if err != nil {
+		return fmt.Errorf( "Error pushing git branch (%v) [%v]: %v", gs.commitBranch, err, se )
+	}
+
+	if gs.opts.ReviewBranch != "" {
+		Out.Info( "Review branch pushed: %v", gs.commitBranch )
+		Out.Info( "Merge it into %v to make the export importable", gs.branchName )
+	}
+
+	return nil
+}
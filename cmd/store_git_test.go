@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+// An export to an existing review branch reports its changes against the
+// version branch, not against the previous review commit.
+func TestGitStoreReviewBranchChanges( t *testing.T ) {
+	useBuiltinKinds( t )
+	git, run := newTestGitRepo( t )
+	dir := git.repoDir
+
+	writeTestObject( t, dir, "README", "objects" )
+	run( "add", "." )
+	run( "commit", "-q", "-m", "base" )
+
+	run( "checkout", "-q", "-b", "v_1" )
+	writeTestObject( t, dir, KIND_DC + "/app.json", `{"replicas":1}` )
+	run( "add", "." )
+	run( "commit", "-q", "-m", "version 1" )
+
+	run( "checkout", "-q", "-b", "review" )
+	writeTestObject( t, dir, KIND_DC + "/app.json", `{"replicas":2}` )
+	run( "add", "." )
+	run( "commit", "-q", "-m", "first review" )
+	run( "checkout", "-q", "master" )
+
+	xr := &XR{}
+	xr.Spec.Format = "json"
+	xr.Spec.Git.Branch.Prefix = "v_"
+	xr.Spec.Git.Branch.BaseRef = "master"
+	gs := &gitStore{ xr: xr, git: git, opts: StoreOptions{ ReviewBranch: "review" } }
+
+	if err := gs.Stage( "1" ); err != nil {
+		t.Fatal( err )
+	}
+	writeTestObject( t, dir, KIND_DC + "/app.json", `{"replicas":2}` )
+
+	cs, err := gs.Changes()
+	if err != nil {
+		t.Fatal( err )
+	}
+	if !reflect.DeepEqual( cs.Modified, []string{ KIND_DC + "/app" } ) || len( cs.Added ) != 0 || len( cs.Deleted ) != 0 {
+		t.Errorf( "changes = %+v, expected %v modified relative to the version branch", cs, KIND_DC + "/app" )
+	}
+
+	// The commit still goes on top of the existing review branch
+	head, _, _ := git.Exec( "rev-parse", "HEAD" )
+	review, _, _ := git.Exec( "rev-parse", "review" )
+	if head != review {
+		t.Errorf( "HEAD %v is not the review branch %v", head, review )
+	}
+}
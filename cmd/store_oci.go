@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"path/filepath"
+)
+
+const (
+	OCI_ARTIFACT_TYPE = "application/vnd.openshift.objectrepository.v1"
+	OCI_OBJECT_MEDIA_TYPE = "application/vnd.openshift.object.v1+json"
+)
+
+var validOCITag = regexp.MustCompile( "^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$" )
+
+// Runs the oras CLI, which performs all registry interaction for the oci store.
+type OrasCmd struct {
+	plainHTTP bool
+	workDir string
+}
+
+func (oras *OrasCmd) Exec( args... string ) (string, string, error) {
+	// Names the missing CLI rather than reporting a bare exec error
+	if _, err := exec.LookPath( "oras" ); err != nil {
+		return "", "", fmt.Errorf( "The oras CLI is required for the oci store: %v", err )
+	}
+	if oras.plainHTTP {
+		args = append( args, "--plain-http" )
+	}
+	if oras.workDir == "" {
+		return Exec( "oras", args... )
+	}
+	cd, err := os.Getwd()
+	if err != nil {
+		return "", "", fmt.Errorf( "Unable to acquire current directory: %v", err )
+	}
+	os.Chdir( oras.workDir )
+	defer os.Chdir( cd )
+	return Exec( "oras", args... )
+}
+
+// Stores each version as an OCI artifact tagged <prefix><version> in a
+// registry repository. Each object file is a layer of the artifact.
+type ociStore struct {
+	*localStore
+	repository string
+	prefix string
+	plainHTTP bool
+}
+
+func newOCIStore( xr *XR, opts StoreOptions ) (ObjectStore, error) {
+	if xr.Spec.OCI.Repository == "" {
+		return nil, fmt.Errorf( "No OCI repository specified" )
+	}
+
+	ls, err := newLocalStore( xr, opts )
+	if err != nil {
+		return nil, err
+	}
+
+	return &ociStore{
+		localStore: ls,
+		repository: xr.Spec.OCI.Repository,
+		prefix: xr.Spec.OCI.Prefix,
+		plainHTTP: xr.Spec.OCI.PlainHTTP,
+	}, nil
+}
+
+func (oci *ociStore) ref( version string ) (string, error) {
+	tag := oci.prefix + version
+	if ! validOCITag.MatchString( tag ) {
+		return "", fmt.Errorf( "Version cannot be used as an OCI tag: %v", tag )
+	}
+	return oci.repository + ":" + tag, nil
+}
+
+func (oci *ociStore) pull( version string, toDir string ) error {
+	ref, err := oci.ref( version )
+	if err != nil {
+		return err
+	}
+	oras := OrasCmd{ plainHTTP: oci.plainHTTP }
+	Out.Info( "Pulling %v", ref )
+	_, se, err := oras.Exec( "pull", ref, "--output", toDir )
+	if err != nil {
+		return fmt.Errorf( "Error pulling OCI artifact (%v) [%v]: %v", ref, err, se )
+	}
+	return nil
+}
+
+func (oci *ociStore) Fetch( version string ) error {
+	return oci.pull( version, oci.objectDir )
+}
+
+func (oci *ociStore) Stage( version string ) error {
+	oci.version = version
+	ref, err := oci.ref( version )
+	if err != nil {
+		return err
+	}
+
+	oras := OrasCmd{ plainHTTP: oci.plainHTTP }
+	_, se, err := oras.Exec( "manifest", "fetch", ref )
+	if err == nil {
+		if ! oci.overwrite {
+			return fmt.Errorf( "Version already exists and --overwrite was not specified: %v", ref )
+		}
+		return oci.pull( version, oci.priorDir )
+	}
+
+	// Only a registry response saying the manifest does not exist proves the
+	// version is new; auth, network and TLS failures must not bypass --overwrite.
+	if ! isOCINotFound( se ) {
+		return fmt.Errorf( "Unable to determine whether version exists (%v) [%v]: %v", ref, err, se )
+	}
+	return nil
+}
+
+// Returns true if oras reported that a manifest or repository does not exist.
+func isOCINotFound( stderr string ) bool {
+	s := strings.ToLower( stderr )
+	for _, marker := range []string{ "manifest unknown", "manifest_unknown", "name unknown", "name_unknown", ": not found", "status code 404", "404 not found" } {
+		if strings.Contains( s, marker ) {
+			return true
+		}
+	}
+	return false
+}
+
+func (oci *ociStore) Publish( message string ) error {
+	ref, err := oci.ref( oci.version )
+	if err != nil {
+		return err
+	}
+
+	// Files are pushed with paths relative to the object directory so that
+	// the <kind>/<name> layout is restored when the artifact is pulled.
+	var layers []string
+	for _, path := range oci.objectFiles( oci.objectDir ) {
+		rel, err := filepath.Rel( oci.objectDir, path )
+		if err != nil {
+			return err
+		}
+		layers = append( layers, filepath.ToSlash( rel ) + ":" + OCI_OBJECT_MEDIA_TYPE )
+	}
+	sort.Strings( layers )
+
+	// Annotation values cannot span lines; keep the commit style subject
+	subject := strings.SplitN( message, "\n", 2 )[0]
+
+	args := []string{ "push", ref,
+		"--artifact-type", OCI_ARTIFACT_TYPE,
+		"--annotation", "org.opencontainers.image.description=" + subject,
+	}
+
+	oras := OrasCmd{ plainHTTP: oci.plainHTTP, workDir: oci.objectDir }
+	_, se, err := oras.Exec( append( args, layers... )... )
+	if err != nil {
+		return fmt.Errorf( "Error pushing OCI artifact (%v) [%v]: %v", ref, err, se )
+	}
+
+	Out.Info( "Published version artifact: %v", ref )
+	return nil
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestIsOCINotFound( t *testing.T ) {
+	notFound := []string{
+		`Error: failed to fetch the content of "registry.example.com/xr:v1": registry.example.com/xr:v1: not found`,
+		`Error response from registry: GET "https://registry.example.com/v2/xr/manifests/v1": response status code 404: manifest unknown: manifest unknown`,
+		`Error response from registry: response status code 404: name unknown: repository name not known to registry`,
+	}
+	for _, se := range notFound {
+		if ! isOCINotFound( se ) {
+			t.Errorf( "expected not found: %v", se )
+		}
+	}
+
+	other := []string{
+		``,
+		`Error response from registry: response status code 401: unauthorized: authentication required`,
+		`Error: Get "https://registry.example.com/v2/": dial tcp: lookup registry.example.com: no such host`,
+		`Error: Get "https://registry.example.com/v2/": tls: failed to verify certificate: x509: certificate signed by unknown authority`,
+	}
+	for _, se := range other {
+		if isOCINotFound( se ) {
+			t.Errorf( "unexpected not found: %v", se )
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"io"
+	"strings"
+	"archive/tar"
+	"compress/gzip"
+	"path/filepath"
+)
+
+// Stores each version as a gzipped tarball: <path>/<prefix><version>.tar.gz
+type tarballStore struct {
+	*localStore
+	path string
+	prefix string
+}
+
+func newTarballStore( xr *XR, opts StoreOptions ) (ObjectStore, error) {
+	if xr.Spec.Tarball.Path == "" {
+		return nil, fmt.Errorf( "No tarball path specified" )
+	}
+
+	ls, err := newLocalStore( xr, opts )
+	if err != nil {
+		return nil, err
+	}
+
+	return &tarballStore{
+		localStore: ls,
+		path: xr.Spec.Tarball.Path,
+		prefix: xr.Spec.Tarball.Prefix,
+	}, nil
+}
+
+func (ts *tarballStore) tarballPath( version string ) string {
+	return filepath.Join( ts.path, ts.prefix + version + ".tar.gz" )
+}
+
+func (ts *tarballStore) Fetch( version string ) error {
+	tarball := ts.tarballPath( version )
+	Out.Info( "Extracting %v", tarball )
+	return extractTarball( tarball, ts.objectDir )
+}
+
+func (ts *tarballStore) Stage( version string ) error {
+	ts.version = version
+	tarball := ts.tarballPath( version )
+
+	if _, err := os.Stat( tarball ); err == nil {
+		if ! ts.overwrite {
+			return fmt.Errorf( "Version already exists and --overwrite was not specified: %v", tarball )
+		}
+		return extractTarball( tarball, ts.priorDir )
+	}
+
+	return nil
+}
+
+func (ts *tarballStore) Publish( message string ) error {
+	tarball := ts.tarballPath( ts.version )
+
+	if err := os.MkdirAll( ts.path, 0700 ); err != nil {
+		return fmt.Errorf( "Error creating repository directory (%v): %v", ts.path, err )
+	}
+
+	staging := tarball + ".tmp"
+	if err := createTarball( ts.objectDir, staging ); err != nil {
+		os.Remove( staging )
+		return err
+	}
+
+	if err := os.Rename( staging, tarball ); err != nil {
+		return fmt.Errorf( "Error moving tarball into place (%v): %v", tarball, err )
+	}
+
+	Out.Info( "Published version tarball: %v", tarball )
+	Out.Debug( "Version message: %v", message )
+	return nil
+}
+
+func extractTarball( tarball string, toDir string ) error {
+	f, err := os.Open( tarball )
+	if err != nil {
+		return fmt.Errorf( "Unable to open tarball (%v): %v", tarball, err )
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader( f )
+	if err != nil {
+		return fmt.Errorf( "Unable to read tarball (%v): %v", tarball, err )
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader( gz )
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf( "Error reading tarball (%v): %v", tarball, err )
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := filepath.Clean( hdr.Name )
+		if filepath.IsAbs( name ) || strings.HasPrefix( name, ".." ) {
+			return fmt.Errorf( "Tarball (%v) contains an entry outside of its root: %v", tarball, hdr.Name )
+		}
+
+		target := filepath.Join( toDir, name )
+		if err := os.MkdirAll( filepath.Dir( target ), 0700 ); err != nil {
+			return fmt.Errorf( "Error creating directory for tarball entry (%v): %v", target, err )
+		}
+
+		out, err := os.OpenFile( target, os.O_CREATE | os.O_TRUNC | os.O_WRONLY, 0600 )
+		if err != nil {
+			return fmt.Errorf( "Error creating file for tarball entry (%v): %v", target, err )
+		}
+		_, err = io.Copy( out, tr )
+		out.Close()
+		if err != nil {
+			return fmt.Errorf( "Error extracting tarball entry (%v): %v", hdr.Name, err )
+		}
+	}
+}
+
+func createTarball( fromDir string, tarball string ) error {
+	f, err := os.OpenFile( tarball, os.O_CREATE | os.O_TRUNC | os.O_WRONLY, 0600 )
+	if err != nil {
+		return fmt.Errorf( "Unable to create tarball (%v): %v", tarball, err )
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter( f )
+	tw := tar.NewWriter( gz )
+
+	err = filepath.Walk( fromDir, func( path string, info os.FileInfo, err error ) error {
+		if err != nil || ! info.Mode().IsRegular() {
+			return err
+		}
+
+		rel, err := filepath.Rel( fromDir, path )
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader( info, "" )
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash( rel )
+
+		if err := tw.WriteHeader( hdr ); err != nil {
+			return err
+		}
+
+		in, err := os.Open( path )
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		_, err = io.Copy( tw, in )
+		return err
+	})
+
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		return fmt.Errorf( "Error writing tarball (%v): %v", tarball, err )
+	}
+	return nil
+}
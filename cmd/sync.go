@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"os"
+	"github.com/spf13/cobra"
+)
+
+type SyncConfig struct {
+	version string
+	message string
+	overwrite bool
+	sourceContext string
+	sourceNamespace string
+	targetContext string
+	targetNamespace string
+	values []string
+	decryptionKey string
+	dryRun bool
+}
+
+var _syncConfig SyncConfig
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync <object-repository-json-file>",
+	Short: "Exports a version from one cluster and replaces it into another",
+	Run: func( cmd *cobra.Command, args []string) {
+		runSync( &_syncConfig, cmd, args )
+	},
+}
+
+func runSync( config *SyncConfig, cmd *cobra.Command, args []string ) {
+
+	if config.sourceContext == "" || config.targetContext == "" {
+		Out.Error( "Both --source-context and --target-context must be specified" )
+		cmd.Help()
+		os.Exit(1)
+	}
+
+	// Both phases share --kubeconfig. --namespace only applies to the export;
+	// the replace uses --target-namespace or the XR's importRules.namespace.
+	source := clusterOptionsFromFlags()
+	source.Context = config.sourceContext
+	if config.sourceNamespace != "" {
+		source.Namespace = config.sourceNamespace
+	}
+
+	target := clusterOptionsFromFlags()
+	target.Context = config.targetContext
+	target.Namespace = ""
+
+	exportConfig := ExportConfig{
+		version: config.version,
+		message: config.message,
+		overwrite: config.overwrite,
+		decryptionKey: config.decryptionKey,
+		cluster: source,
+		dryRun: config.dryRun,
+		keepStaged: config.dryRun,
+	}
+
+	Out.Info( "Exporting from context: %v", source.Context )
+
+	// runExport exits the process on failure, so replace is never reached
+	// after a failed export.
+	runExport( &exportConfig, cmd, args )
+
+	replaceConfig := ReplaceConfig{
+		version: exportConfig.version,
+		targetNamespace: config.targetNamespace,
+		values: config.values,
+		decryptionKey: config.decryptionKey,
+		cluster: target,
+		dryRun: config.dryRun,
+		generatedTag: exportConfig.generatedTag,
+	}
+
+	if exportConfig.stagedStore != nil {
+		// The version was not published; replace from what would have been.
+		defer exportConfig.stagedStore.Close()
+		replaceConfig.objectDir = exportConfig.stagedStore.ObjectDir()
+	}
+
+	Out.Info( "Replacing into context: %v", target.Context )
+	runReplace( &replaceConfig, cmd, args )
+}
+
+func init() {
+	RootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().StringVar(&_syncConfig.version, "version", "", "Version to export and replace")
+	syncCmd.Flags().StringVar(&_syncConfig.message, "message", "", "Message for commits")
+	syncCmd.Flags().BoolVar(&_syncConfig.overwrite, "overwrite", false, "Specify to permit version overwrites")
+	syncCmd.Flags().StringVar(&_syncConfig.sourceContext, "source-context", "", "Kubeconfig context to export from")
+	syncCmd.Flags().StringVar(&_syncConfig.sourceNamespace, "source-namespace", "", "Namespace to export from if not the source context's")
+	syncCmd.Flags().StringVar(&_syncConfig.targetContext, "target-context", "", "Kubeconfig context to replace into")
+	syncCmd.Flags().StringVar(&_syncConfig.targetNamespace, "target-namespace", "", "Namespace to replace into if not the target context's")
+	syncCmd.Flags().StringArrayVar(&_syncConfig.values, "values", nil, "YAML file of parameter values for the replace; may be repeated with later files taking precedence")
+	syncCmd.Flags().StringVar(&_syncConfig.decryptionKey, "decryption-key", "", "Private key file for encrypted secrets (default $" + ENV_DECRYPTION_KEY + ")")
+	syncCmd.Flags().BoolVar(&_syncConfig.dryRun, "dry-run", false, "Report what would be exported and replaced without changing anything")
+}
@@ -6,10 +6,12 @@ import (
 	"io"
 	"time"
 	"strings"
-	"regexp"
 	"os/exec"
 	"bytes"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"encoding/json"
 	"io/ioutil"
 )
@@ -53,45 +55,24 @@ func (o *Output) Out( format string, vals... interface{} ) {
 	o.toWriter( os.Stdout, format, vals... )
 }
 
-var endsWithVowelThenY = regexp.MustCompile( ".*[aeiou]y$" )
-
-func pluralizeKind( kind string ) string {
-	kind = strings.TrimSpace( kind )
-	kind = strings.ToLower( kind )
-
-	if kind == "" {
-		return kind
-	}
-
-	switch kind {
-	case "dc" : kind = "deploymentconfigs"
-	case "bc" : kind = "buildconfigs"
-	case "svc" : kind = "services"
-	case "is" : kind = "imagestreams"
-	case "rc" : kind = "replicationcontrollers"
-	case "po" : kind = "pods"
-	}
-
-	if strings.HasSuffix( kind, "s" ) {
-		return kind
-	}
-	if strings.HasSuffix( kind, "y" ) == false || endsWithVowelThenY.MatchString(kind) {
-		return kind + "s"
-	}
-	return kind + "ies"
-}
-
-// Normalizes kind or kind/name strings to lowercase, pluralized form
+// Normalizes kind or kind/name strings so that the kind is the group
+// qualified resource name served by the cluster (e.g. "dc/ruby" becomes
+// "deploymentconfigs.apps.openshift.io/ruby"). Unknown kinds are lowercased.
 func NormalizeType( res string ) string {
 	res = strings.TrimSpace( res )
-	res = strings.ToLower( res )
 
-	if res == "" || res == "all" {
-		return res
+	if res == "" || strings.ToLower( res ) == "all" {
+		return strings.ToLower( res )
+	}
+
+	components := strings.SplitN( res, "/", 2 )
+	if rt, ok := Kinds().Resolve( components[0] ); ok {
+		components[0] = rt.Name()
+	} else {
+		Out.Debug( "Unknown kind %q; using it verbatim", components[0] )
+		components[0] = strings.ToLower( components[0] )
 	}
 
-	components := strings.Split( res, "/" )
-	components[0] = pluralizeKind( components[0])
 	if len( components ) > 1 && components[ 1 ] != "" {
 		return strings.Join( components, "/" )
 	} else {
@@ -104,13 +85,23 @@ func NormalizeType( res string ) string {
 func ToKindNameList( list string ) ([]string) {
 	var arr []string
 	for _,entry := range strings.Split(list, ",") {
-		// Normalize the list.. lowercase, pluralized full kind name
+		entry = strings.TrimSpace( entry )
+		if strings.HasPrefix( entry, KIND_NAME_REGEX_PREFIX ) {
+			// Regular expressions match the normalized kind/name verbatim
+			arr = append( arr, entry )
+			continue
+		}
+		// Normalize the list.. group qualified resource name
 		entry = NormalizeType( entry )
 		arr = append( arr, entry)
 	}
 	return arr
 }
 
+// Returns the kind/name of an object file exactly as it is laid out on disk.
+// Use NormalizeType on the result before comparing it with kind/name lists;
+// repositories written before kinds were group qualified use bare resource
+// names (e.g. deploymentconfigs/) for their directories.
 func GetFullObjectNameFromPath( filename string ) string {
 	kindDir, name := filepath.Split( filename )
 	name = strings.TrimSuffix( name, ".json" )
@@ -139,10 +130,10 @@ func FindAllKindFiles( xr *XR, baseDir string ) (map[string]string) {
 		// We might have source code to avoid. Preferably, the user
 		// would have used branch.prefix, but alas, avoid a bunch
 		// of warnings.
-		if ! strings.HasSuffix( path, "." + xr.Spec.Git.Format ) {
+		if ! strings.HasSuffix( path, "." + xr.Spec.Format ) {
 			return nil
 		}
-		fullName := GetFullObjectNameFromPath( path )
+		fullName := NormalizeType( GetFullObjectNameFromPath( path ) )
 		m[ fullName ] = path
 		return nil
 	})
@@ -154,50 +145,9 @@ func FindAllKindFiles( xr *XR, baseDir string ) (map[string]string) {
 // Returns a map of kind/name => filename
 func FindKindNameFiles( xr *XR, baseDir string, list string ) (map[string]string) {
 	m := make(map[string]string)
-	for _, i := range ToKindNameList( list ) {
-
-		if i == "all" {
-			return FindAllKindFiles( xr, baseDir )
-		}
-
-		components := strings.Split( i, "/" )
-		entryPath := filepath.Join( append( []string{ baseDir }, components... )... )
-
-		// If there are two components to the name (e.g. deploymentconfigs/ruby), we are looking for JSON file
-		if ( len( components ) == 2 ) {
-			entryPath += "." + xr.Spec.Git.Format
-		}
-
-		f, err := os.Open(entryPath)
-		if err != nil {
-			continue
-		}
-		defer f.Close()
-
-		fi, err := f.Stat()
-		if err != nil {
-			continue
-		}
-
-		if fi.Mode().IsRegular() {
-			fullName := GetFullObjectNameFromPath( entryPath )
-			m[ fullName ] = entryPath
-			continue
-		}
-
-		if fi.Mode().IsDir() {
-			filepath.Walk(entryPath, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					Out.Warn( "Unable to walk path [%v]: %v", err, path )
-					return nil
-				}
-				if ! info.Mode().IsRegular() {
-					return nil
-				}
-				fullName := GetFullObjectNameFromPath( path )
-				m[ fullName ] = path
-				return nil
-			})
+	for fullName, path := range FindAllKindFiles( xr, baseDir ) {
+		if IsMatchedByKindNameList( fullName, list ) {
+			m[ fullName ] = path
 		}
 	}
 	return m
@@ -208,15 +158,11 @@ func FindKindNameFiles( xr *XR, baseDir string, list string ) (map[string]string
 func FindLiveKindNameMap( kindNameList string ) map[string]struct{} {
 	m := make( map[string]struct{} )
 	for _, i := range ToKindNameList( kindNameList ) {
-		newlineNames, _, err := OC.Exec("get", i, "-o=name")
+		names, err := OC.Names( OC.Namespace(), i, "" )
 		if err != nil {
 			continue
 		}
-		for _, objName := range strings.Split( newlineNames, "\n" ) {
-			objName = NormalizeType(objName)
-			if objName == "" {
-				continue
-			}
+		for _, objName := range names {
 			m[ objName ] = struct{}{}
 		}
 	}
@@ -236,29 +182,29 @@ func Exec( command string, args... string) (string, string, error) {
 	stdErrBytes := stdErrBuff.Bytes()
 	stdOut := strings.TrimSpace(string(stdOutBytes))
 	stdErr := strings.TrimSpace(string(stdErrBytes))
-	switch err.(type) {
-	case nil:
-		return stdOut, stdErr, nil
-	case *exec.ExitError:
-		return stdOut, stdErr, err
-	default:
-		return "", "", nil
-	}
+	// err is also set when the command could not be started
+	return stdOut, stdErr, err
 }
 
-type OpenShiftCmd struct {
-}
-var OC OpenShiftCmd
-func (oc *OpenShiftCmd) Exec( args... string) (string, string, error) {
-	return Exec( "oc", args...)
+// Executes a command with input on stdin. Unlike Exec, stdout is returned
+// unmodified so that binary output survives.
+func ExecInput( input []byte, command string, args... string) ([]byte, string, error) {
+	return ExecInputEnv( input, nil, command, args... )
 }
 
-func (oc *OpenShiftCmd) Project() (string, error) {
-	projectName, se, err := oc.Exec("project", "-q")
-	if err != nil {
-		return "", fmt.Errorf( "[%v]: %v", err, se )
+// Like ExecInput, but env (KEY=value) is added to the environment.
+func ExecInputEnv( input []byte, env []string, command string, args... string) ([]byte, string, error) {
+	Out.Debug( "Executing (%v): %v", command, strings.Join( args, " " ) )
+	cmd := exec.Command( command, args...)
+	if len( env ) > 0 {
+		cmd.Env = append( os.Environ(), env... )
 	}
-	return projectName, nil
+	var stdErrBuff, stdOutBuff bytes.Buffer
+	cmd.Stdin = bytes.NewReader( input )
+	cmd.Stdout = &stdOutBuff
+	cmd.Stderr = &stdErrBuff
+	err := cmd.Run()
+	return stdOutBuff.Bytes(), strings.TrimSpace( stdErrBuff.String() ), err
 }
 
 type GitCmd struct {
@@ -319,7 +265,7 @@ func dockerPatternMatches( imageRef, pattern, internalRegistryIP, projectName st
 
 	registry, namespace, repo, tag, err := ParseDockerImageRef( imageRef )
 	if err != nil {
-		return false, fmt.Errorf( "Invalid image reference (%v): %v", pattern, err )
+		return false, err
 	}
 
 	if !( pRegistry == "*/" || ( pRegistry == "~/" && strings.HasPrefix( registry, internalRegistryIP ) ) || pRegistry == registry ) {
@@ -363,8 +309,8 @@ func ParseDockerImageRef( ref string ) (registry, namespace, repo, tag string, e
 	case 1:
 		repo = components[0]
 	default:
-		fmt.Errorf( "Invalid docker image reference: %v", ref )
-		os.Exit(1)
+		err = fmt.Errorf( "Invalid docker image reference: %v", ref )
+		return
 	}
 
 	// Repo still potentially contains @sha256 or normal tag
@@ -384,16 +330,23 @@ func ParseDockerImageRef( ref string ) (registry, namespace, repo, tag string, e
 
 const (
 	KIND_RC = "replicationcontrollers"
-	KIND_DC = "deploymentconfigs"
-	KIND_BC = "buildconfigs"
-	KIND_IS = "imagestreams"
+	KIND_DC = "deploymentconfigs.apps.openshift.io"
+	KIND_BC = "buildconfigs.build.openshift.io"
+	KIND_IS = "imagestreams.image.openshift.io"
 	KIND_CONFIGMAP = "configmaps"
 	KIND_SECRET = "secrets"
 	KIND_PV = "persistentvolumes"
 	KIND_PVC = "persistentvolumeclaims"
+	KIND_SA = "serviceaccounts"
+	KIND_SERVICE = "services"
+	KIND_ROUTE = "routes.route.openshift.io"
+	KIND_DEPLOYMENT = "deployments.apps"
+	KIND_REPLICASET = "replicasets.apps"
+	KIND_STATEFULSET = "statefulsets.apps"
 
 	LABEL_REPOSITORY = "openshift.io/repository"
 	LABEL_REPOSITORY_VERSION = "openshift.io/repository-version"
+	ANNOTATION_REDACTED = "openshift.io/repository-redacted"
 )
 
 func  GetJSONPath( from interface{}, names ...string ) interface{} {
@@ -441,15 +394,29 @@ func ReadXR( filename string ) (*XR, error) {
 		return nil, fmt.Errorf( "Error parsing XR file (%v): %v", filename, err )
 	}
 
+	// As before other store types existed, the type must be stated
 	xr.Spec.Type = strings.ToLower( xr.Spec.Type )
-	xr.Spec.Git.Format = strings.ToLower( xr.Spec.Git.Format )
+	if xr.Spec.Type == "" {
+		return nil, fmt.Errorf( "XR file (%v) must specify spec.type (%v, %v, %v or %v)", filename, STORE_GIT, STORE_DIRECTORY, STORE_TARBALL, STORE_OCI )
+	}
 
-	if xr.Spec.Type != "git" || xr.Spec.Git.Format != "json" {
-		return nil, fmt.Errorf( "Only git/json ObjectRepositories are presently supported")
+	// Format was originally only configurable for git repositories
+	if xr.Spec.Format == "" {
+		xr.Spec.Format = xr.Spec.Git.Format
+	}
+	xr.Spec.Format = strings.ToLower( xr.Spec.Format )
+	if xr.Spec.Format == "" {
+		xr.Spec.Format = "json"
+	}
+	xr.Spec.Git.Format = xr.Spec.Format
+
+	if xr.Spec.Format != "json" {
+		return nil, fmt.Errorf( "Only json ObjectRepositories are presently supported")
 	}
 
-	if xr.Spec.Git.URI == "" {
-		return nil, fmt.Errorf( "No Git URI specified")
+	err = validateXRKindNameLists( &xr )
+	if err != nil {
+		return nil, fmt.Errorf( "Invalid XR file (%v): %v", filename, err )
 	}
 
 	return &xr, nil
@@ -541,7 +508,7 @@ func spiderInner( kind string, from string, at interface{}, walk func( kind stri
 
 func SpiderObject( from interface{}, walk func( kind string, key string, m map[string]interface{} ) ) {
 	obj := from.(map[string]interface{})
-	kind := pluralizeKind( GetJSONPath( obj, "kind" ).(string) )
+	kind := ObjectKind( obj )
 	spiderInner( kind, "", obj, walk )
 }
 
@@ -566,42 +533,158 @@ func SetAnnotation( in interface{}, key string, val string ) {
 	SetJSONObj( metadata, "annotations", annotations )
 }
 
-func RunPatches( xr *XR, baseDir string ) error {
-	for _, patch := range xr.Spec.ExportRules.Transforms.Patches {
-		if patch.Type != "jq" {
-			return fmt.Errorf( "Patch type is not supported: %v", patch.Type )
+// Kind/name list entries with this prefix are regular expressions matched
+// against normalized kind/name strings (e.g. "re:^secrets/db-.*$").
+const KIND_NAME_REGEX_PREFIX = "re:"
+
+var kindNameRegexps = map[string]*regexp.Regexp{}
+
+// Returns true if a kind/name list entry is a glob or regular expression
+// rather than a kind or kind/name.
+func IsKindNamePattern( entry string ) bool {
+	return strings.HasPrefix( entry, KIND_NAME_REGEX_PREFIX ) || strings.ContainsAny( entry, "*?[" )
+}
+
+// Returns the kind matched by a pattern entry if it names exactly one kind
+// (e.g. "configmaps" for "configmaps/app-*").
+func KindNamePatternKind( entry string ) (string, bool) {
+	if strings.HasPrefix( entry, KIND_NAME_REGEX_PREFIX ) {
+		return "", false
+	}
+	kind := strings.SplitN( entry, "/", 2 )[0]
+	if strings.ContainsAny( kind, "*?[" ) {
+		return "", false
+	}
+	return kind, true
+}
+
+func isMatchedByKindNameEntry( fullResName, entry string ) bool {
+	if entry == "all" || fullResName == entry || strings.HasPrefix( fullResName, entry+"/" ) {
+		return true
+	}
+
+	if strings.HasPrefix( entry, KIND_NAME_REGEX_PREFIX ) {
+		re, ok := kindNameRegexps[ entry ]
+		if !ok {
+			// Lists from the XR are validated by ReadXR
+			re = regexp.MustCompile( strings.TrimPrefix( entry, KIND_NAME_REGEX_PREFIX ) )
+			kindNameRegexps[ entry ] = re
 		}
-		for _,fileToPatch := range FindKindNameFiles( xr, baseDir, patch.Match ) {
-			so, se, err := Exec( "jq", patch.Patch, fileToPatch )
-			if err != nil {
-				return fmt.Errorf( "Error running jq patch operation on %v [%v]: %v", fileToPatch, err, se )
+		return re.MatchString( fullResName )
+	}
+
+	if ! strings.ContainsAny( entry, "*?[" ) {
+		return false
+	}
+
+	// Globs match the kind and name separately so that * does not span the /
+	entryComponents := strings.SplitN( entry, "/", 2 )
+	nameComponents := strings.SplitN( fullResName, "/", 2 )
+	if ok, _ := path.Match( entryComponents[0], nameComponents[0] ); !ok {
+		return false
+	}
+	if len( entryComponents ) == 1 {
+		return true
+	}
+	if len( nameComponents ) == 1 {
+		return false
+	}
+	ok, _ := path.Match( entryComponents[1], nameComponents[1] )
+	return ok
+}
+
+// Checks that every glob and regular expression in a kind/name list is
+// well formed. Regular expressions are compiled once here and reused when
+// matching.
+func ValidateKindNameList( list string ) error {
+	for _, entry := range ToKindNameList( list ) {
+		if strings.HasPrefix( entry, KIND_NAME_REGEX_PREFIX ) {
+			if _, ok := kindNameRegexps[ entry ]; ok {
+				continue
 			}
-			fullName := GetFullObjectNameFromPath( fileToPatch )
-			Out.Info( "Applying patch [%v]: %v", patch.Patch, fullName)
-			// Overwrite the prior file with the patched version
-			err = ioutil.WriteFile( fileToPatch, []byte(so), 0600 )
+			re, err := regexp.Compile( strings.TrimPrefix( entry, KIND_NAME_REGEX_PREFIX ) )
 			if err != nil {
-				return fmt.Errorf("Error writing patch result on %v: %v", fileToPatch, err )
+				return fmt.Errorf( "Invalid regular expression in kind/name list (%v): %v", entry, err )
+			}
+			kindNameRegexps[ entry ] = re
+			continue
+		}
+		if ! strings.ContainsAny( entry, "*?[" ) {
+			continue
+		}
+		for _, component := range strings.SplitN( entry, "/", 2 ) {
+			if _, err := path.Match( component, "" ); err != nil {
+				return fmt.Errorf( "Invalid glob in kind/name list (%v): %v", entry, err )
 			}
 		}
 	}
 	return nil
 }
 
+// Validates every kind/name list and match field in the XR so that a
+// malformed pattern stops the run instead of silently matching nothing.
+func validateXRKindNameLists( xr *XR ) error {
+	export := &xr.Spec.ExportRules
+	imp := &xr.Spec.ImportRules
+	lists := map[string]string{
+		"exportRules.include": export.Include,
+		"exportRules.exclude": export.Exclude,
+		"exportRules.transforms.preserveMutators": export.Transforms.PreserveMutators,
+		"importRules.include": imp.Include,
+		"importRules.exclude": imp.Exclude,
+	}
+	for i, r := range export.Transforms.Cleanup.Remove {
+		lists[ fmt.Sprintf( "exportRules.transforms.cleanup.remove[%v].match", i ) ] = r.Match
+	}
+	for i, p := range export.Transforms.Patches {
+		lists[ fmt.Sprintf( "exportRules.transforms.patches[%v].match", i ) ] = p.Match
+	}
+	for i, p := range xr.Spec.Parameters {
+		for j, t := range p.Targets {
+			lists[ fmt.Sprintf( "parameters[%v].targets[%v].match", i, j ) ] = t.Match
+		}
+	}
+	for i, p := range imp.Transforms.Patches {
+		lists[ fmt.Sprintf( "importRules.transforms.patches[%v].match", i ) ] = p.Match
+	}
+	for i, r := range imp.Transforms.Renames {
+		lists[ fmt.Sprintf( "importRules.transforms.renames[%v].match", i ) ] = r.Match
+	}
+	for i, r := range imp.Transforms.Labels {
+		lists[ fmt.Sprintf( "importRules.transforms.labels[%v].match", i ) ] = r.Match
+	}
+	for i, r := range imp.Transforms.Annotations {
+		lists[ fmt.Sprintf( "importRules.transforms.annotations[%v].match", i ) ] = r.Match
+	}
+	for i, w := range imp.Transforms.Workloads {
+		lists[ fmt.Sprintf( "importRules.transforms.workloads[%v].match", i ) ] = w.Match
+	}
+	for i, r := range imp.Transforms.Routes {
+		lists[ fmt.Sprintf( "importRules.transforms.routes[%v].match", i ) ] = r.Match
+	}
+
+	var fields []string
+	for field := range lists {
+		fields = append( fields, field )
+	}
+	sort.Strings( fields )
+	for _, field := range fields {
+		if err := ValidateKindNameList( lists[ field ] ); err != nil {
+			return fmt.Errorf( "%v: %v", field, err )
+		}
+	}
+	return nil
+}
+
 func IsMatchedByKindNameList( fullResName, list string ) bool {
 	for _, entry := range ToKindNameList( list ) {
-		if entry == "all" || fullResName == entry || strings.HasPrefix( fullResName, entry+"/" ) {
+		if isMatchedByKindNameEntry( fullResName, entry ) {
 			return true
 		}
 	}
 	return false
 }
 
-type Template struct {
-	Kind string `json:"kind"`
-	Objects []interface{} `json:"objects"`
-}
-
 // Converter: https://mholt.github.io/json-to-go/
 type XR struct {
 	Kind string `json:"kind"`
@@ -610,20 +693,47 @@ type XR struct {
 	} `json:"metadata"`
 	Spec struct {
 		Type string `json:"type"`
+		Format string `json:"format"`
 		DefaultVersion string `json:"defaultVersion"`
+		Parameters []Parameter `json:"parameters"`
+		Encryption struct {
+			Format string `json:"format"` // age or openpgp
+			Recipients []string `json:"recipients"`
+		} `json:"encryption"`
 		Git struct {
 			URI string `json:"uri"`
 			Format string `json:"format"`
 			HttpProxy string `json:"httpProxy"`
 			HttpsProxy string `json:"httpsProxy"`
 			Secret string `json:"string"`
+			Signing struct {
+				Format string `json:"format"`
+				Key string `json:"key"`
+			} `json:"signing"`
+			AllowedSigners []string `json:"allowedSigners"`
 			Branch struct {
 				ContextDir string `json:"contextDir"`
 				Prefix string `json:"prefix"`
 				BaseRef string `json:"baseRef"`
 			} `json:"branch"`
 		} `json:"git"`
+		Directory struct {
+			Path string `json:"path"`
+			Prefix string `json:"prefix"`
+		} `json:"directory"`
+		Tarball struct {
+			Path string `json:"path"`
+			Prefix string `json:"prefix"`
+		} `json:"tarball"`
+		OCI struct {
+			Repository string `json:"repository"`
+			Prefix string `json:"prefix"`
+			PlainHTTP bool `json:"plainHTTP"`
+		} `json:"oci"`
 		ExportRules struct {
+			Kubeconfig string `json:"kubeconfig"`
+			Context string `json:"context"`
+			Namespace string `json:"namespace"`
 			Selectors []struct {
 				Namespace string `json:"namespace"`
 				MatchLabels []string `json:"matchLabels"`
@@ -631,23 +741,23 @@ type XR struct {
 			} `json:"selectors"`
 			Include string `json:"include"`
 			Exclude string `json:"exclude"`
+			Ignore *string `json:"ignore"`
+			IncludeDependencies bool `json:"includeDependencies"`
+			Secrets struct {
+				Mode string `json:"mode"` // include (default), redact or skip
+			} `json:"secrets"`
 			Transforms struct {
 				PreserveMutators string `json:"preserveMutators"`
-			   	Patches []struct {
-					Match string `json:"match"`
-					Patch string `json:"patch"`
-					Type string `json:"type"`
-				} `json:"patches"`
-				ImageMappings []struct {
-					Pattern string `json:"pattern"`
-					SetRegistryHost *string `json:"setRegistryHost"`
-					SetNamespace *string `json:"setNamespace"`
-					SetRepository *string `json:"setRepository"`
-					SetTag *string `json:"setTag"`
-					Push *bool `json:"push"`
-					TagType string `json:"tagType"`
-					Secret string `json:"secret"`
-				} `json:"imageMappings"`
+				Cleanup struct {
+					DisableDefaults bool `json:"disableDefaults"`
+					Keep []string `json:"keep"` // default paths to retain
+					Remove []CleanupRule `json:"remove"`
+					PreserveOwnerReferences bool `json:"preserveOwnerReferences"`
+				} `json:"cleanup"`
+			   	Patches []Patch `json:"patches"`
+				ImageMappings []ExportImageMapping `json:"imageMappings"`
+				ImageTriggers string `json:"imageTriggers"` // strip (default) or rewrite
+				IntegratedRegistry string `json:"integratedRegistry"` // used by imageTriggers rewrite
 			} `json:"transforms"`
 		} `json:"exportRules"`
 		ImportRules struct {
@@ -656,20 +766,31 @@ type XR struct {
 			Namespace string `json:"namespace"`
 			Transforms struct {
 				NamePrefix struct {
-					NamePrefixDefault string `json:default`
+					NamePrefixDefault string `json:"default"`
 					Labels map[string]string `json:"labels"`
 			   	} `json:"namePrefix"`
-				Patches []struct {
-					Match string `json:"match"`
-					Patch string `json:"patch"`
-					Type string `json:"type"`
-				} `json:"patches"`
+				NameSuffix struct {
+					NameSuffixDefault string `json:"default"`
+					Labels map[string]string `json:"labels"`
+				} `json:"nameSuffix"`
+				Renames []RenameRule `json:"renames"`
+				Labels []MetadataRule `json:"labels"`
+				Annotations []MetadataRule `json:"annotations"`
+				Workloads []WorkloadOverride `json:"workloads"`
+				Routes []RouteTransform `json:"routes"`
+				Storage struct {
+					ClassMappings map[string]string `json:"classMappings"`
+					// Keeps claims' volumeName and bind annotations on export and import
+					PreserveVolumeBindings bool `json:"preserveVolumeBindings"`
+				} `json:"storage"`
+				Patches []Patch `json:"patches"`
 				ImageMappings []struct {
 					Pattern string `json:"pattern"`
 					SetRegistryHost *string `json:"setRegistryHost"`
 					SetNamespace *string `json:"setNamespace"`
 					SetRepository *string `json:"setRepository"`
 					SetTag *string `json:"setTag"`
+					TagType string `json:"tagType"`
 				} `json:"imageMappings"`
 			} `json:"transforms"`
 		} `json:"importRules"`
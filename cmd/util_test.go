@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestValidateKindNameList( t *testing.T ) {
+	useBuiltinKinds( t )
+	valid := []string{
+		"",
+		"secrets, configmaps/app",
+		"secrets/db-*, configmaps/app-?",
+		"re:^secrets/db-.*$",
+	}
+	for _, list := range valid {
+		if err := ValidateKindNameList( list ); err != nil {
+			t.Errorf( "ValidateKindNameList(%q): unexpected error %v", list, err )
+		}
+	}
+
+	invalid := []string{
+		"re:^secrets/(db",
+		"secrets/db-[",
+		"configmaps, secrets[/db",
+	}
+	for _, list := range invalid {
+		if err := ValidateKindNameList( list ); err == nil {
+			t.Errorf( "ValidateKindNameList(%q): expected an error", list )
+		}
+	}
+}
+
+func TestIsMatchedByKindNameList( t *testing.T ) {
+	useBuiltinKinds( t )
+	cases := []struct {
+		fullName string
+		list string
+		expected bool
+	}{
+		{ "secrets/db-password", "secrets", true },
+		{ "secrets/db-password", "secrets/db-*", true },
+		{ "secrets/db-password", "configmaps/db-*", false },
+		{ "secrets/db-password", "re:^secrets/db-", true },
+		{ "secrets/app", "re:^secrets/db-", false },
+	}
+	for _, tc := range cases {
+		if err := ValidateKindNameList( tc.list ); err != nil {
+			t.Fatalf( "ValidateKindNameList(%q): %v", tc.list, err )
+		}
+		if IsMatchedByKindNameList( tc.fullName, tc.list ) != tc.expected {
+			t.Errorf( "IsMatchedByKindNameList(%q, %q) != %v", tc.fullName, tc.list, tc.expected )
+		}
+	}
+}
+
+func TestExecErrors( t *testing.T ) {
+	cases := []struct {
+		command string
+		args []string
+		expectError bool
+		exitError bool
+	}{
+		{ "sh", []string{ "-c", "echo out; echo err >&2" }, false, false },
+		{ "sh", []string{ "-c", "exit 2" }, true, true },
+		// Commands which cannot be started are reported rather than treated as success
+		{ "xrutil-missing-command", nil, true, false },
+	}
+	for _, tc := range cases {
+		so, se, err := Exec( tc.command, tc.args... )
+		if ( err != nil ) != tc.expectError {
+			t.Errorf( "Exec(%v %v): error %v", tc.command, tc.args, err )
+		}
+		if _, ok := err.(*exec.ExitError); ok != tc.exitError {
+			t.Errorf( "Exec(%v %v): error %T, exit error expected %v", tc.command, tc.args, err, tc.exitError )
+		}
+		if err == nil && ( so != "out" || se != "err" ) {
+			t.Errorf( "Exec(%v %v) = %q, %q", tc.command, tc.args, so, se )
+		}
+	}
+}
+
+func TestGitCallersReportMissingGit( t *testing.T ) {
+	useBuiltinKinds( t )
+	git, run := newTestGitRepo( t )
+	writeTestObject( t, git.repoDir, "configmaps/settings.json", `{}` )
+	run( "add", "." )
+	run( "commit", "-q", "-m", "v1" )
+
+	// Without git on the PATH, callers must fail instead of seeing empty output
+	t.Setenv( "PATH", t.TempDir() )
+	if _, _, err := git.Exec( "status" ); err == nil {
+		t.Error( "GitCmd.Exec: expected an error when git cannot be run" )
+	}
+	xr := &XR{}
+	xr.Spec.Format = "json"
+	if cs, err := git.StagedChanges( xr, "HEAD" ); err == nil {
+		t.Errorf( "StagedChanges: expected an error when git cannot be run, got %v", cs )
+	}
+}